@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package shellwords
+
+import "os"
+
+// access reports whether the permission bits perm of fi allow anyone to
+// read, write or run the file, as the owner of the file isn't known here.
+func access(name string, fi os.FileInfo, perm os.FileMode) bool {
+	return fi.Mode().Perm()&perm != 0
+}
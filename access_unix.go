@@ -0,0 +1,16 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package shellwords
+
+import (
+	"os"
+	"syscall"
+)
+
+// access reports whether this process may read, write or run the file at
+// name, as perm 0444, 0222 or 0111 asks.
+func access(name string, fi os.FileInfo, perm os.FileMode) bool {
+	// The bits for others are the ones access(2) takes.
+	return syscall.Access(name, uint32(perm&7)) == nil
+}
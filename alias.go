@@ -0,0 +1,88 @@
+package shellwords
+
+import (
+	"strings"
+)
+
+// expandAliases replaces the first word of src and the words which follow
+// an alias ending with a blank by their aliases. Aliases in seen are being
+// expanded already and are left alone. blank tells if src ended with such
+// an alias, in which case the word after src is to be checked as well.
+func (p *Parser) expandAliases(src string, seen map[string]bool, regions *[]region) (out string, blank bool) {
+	var b strings.Builder
+	lx := &scriptLexer{p: p, src: src}
+	last := 0
+	for {
+		t, err := lx.scan()
+		if err != nil || t.kind != tWord {
+			break
+		}
+		if isAssignment(t.val) {
+			continue
+		}
+		value, ok := p.Aliases[t.val]
+		if !ok || seen[t.val] {
+			blank = false
+			break
+		}
+		seen[t.val] = true
+		inner, innerBlank := p.expandAliases(value, seen, nil)
+		delete(seen, t.val)
+
+		b.WriteString(src[last:t.span.Start])
+		start := b.Len()
+		b.WriteString(inner)
+		if regions != nil {
+			*regions = append(*regions, region{Start: start, End: b.Len(), Span: t.span})
+		}
+		last = t.span.End
+		blank = innerBlank || strings.TrimRight(value, " \t") != value
+		if !blank {
+			break
+		}
+	}
+	b.WriteString(src[last:])
+	return b.String(), blank
+}
+
+// parseAliasTokens is ParseTokens after history expansion.
+func (p *Parser) parseAliasTokens(line string) ([]Token, error) {
+	if len(p.Aliases) == 0 {
+		return p.parseTokens(line)
+	}
+	var regions []region
+	expanded, _ := p.expandAliases(line, map[string]bool{}, &regions)
+	return p.parseExpanded(line, expanded, regions, p.parseTokens)
+}
+
+// alias returns t, or the first token of its alias if it has one. The rest
+// of the expansion is read next.
+func (lx *scriptLexer) alias(t scriptToken) (scriptToken, error) {
+	if t.kind != tWord || t.alias {
+		return t, nil
+	}
+	if _, ok := lx.p.Aliases[t.val]; !ok {
+		return t, nil
+	}
+	value, blank := lx.p.expandAliases(t.val, map[string]bool{}, nil)
+	sub := &scriptLexer{p: lx.p, src: value}
+	var tokens []scriptToken
+	for {
+		u, err := sub.scan()
+		if err != nil {
+			msg := err.Error()
+			if e, ok := err.(*SyntaxError); ok {
+				msg = e.Msg
+			}
+			return scriptToken{}, &SyntaxError{Span: t.span, Msg: "in alias " + t.val + ": " + msg}
+		}
+		if u.kind == tEOF {
+			break
+		}
+		u.span, u.alias = t.span, true
+		tokens = append(tokens, u)
+	}
+	lx.queue = append(tokens, lx.queue...)
+	lx.chain = blank
+	return lx.next()
+}
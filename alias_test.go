@@ -0,0 +1,121 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testAliases = map[string]string{
+	"ll":   "ls -la",
+	"ls":   "ls --color",
+	"sudo": "sudo ",
+	"nice": "nice -n 5 ",
+	"a":    "b",
+	"b":    "a x",
+	"q":    "echo 'a b'",
+	"e":    "",
+}
+
+func TestAliases(t *testing.T) {
+	var tests = []struct {
+		line string
+		args []string
+	}{
+		{`ll dir`, []string{"ls", "--color", "-la", "dir"}},
+		{`ls`, []string{"ls", "--color"}},
+		{`'ll' ll`, []string{"ll", "ll"}},
+		{`sudo ll`, []string{"sudo", "ls", "--color", "-la"}},
+		{`sudo nice ll x`, []string{"sudo", "nice", "-n", "5", "ls", "--color", "-la", "x"}},
+		{`sudo x ll`, []string{"sudo", "x", "ll"}},
+		{`FOO=1 ll`, []string{"FOO=1", "ls", "--color", "-la"}},
+		{`a`, []string{"a", "x"}},
+		{`q c`, []string{"echo", "a b", "c"}},
+		{`e foo`, []string{"foo"}},
+		{`echo ll`, []string{"echo", "ll"}},
+	}
+	for _, test := range tests {
+		parser := NewParser()
+		parser.Aliases = testAliases
+		args, err := parser.Parse(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("%q: Expected %#v, but %#v", test.line, test.args, args)
+		}
+	}
+}
+
+func TestAliasesSpan(t *testing.T) {
+	parser := NewParser()
+	parser.Aliases = testAliases
+	line := `sudo ll "x y"; next`
+	tokens, err := parser.ParseTokens(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Token{
+		{Kind: TokenWord, Value: "sudo", Span: Span{0, 4}},
+		{Kind: TokenWord, Value: "ls", Span: Span{5, 7}},
+		{Kind: TokenWord, Value: "--color", Span: Span{5, 7}},
+		{Kind: TokenWord, Value: "-la", Span: Span{5, 7}},
+		{Kind: TokenWord, Value: "x y", Span: Span{8, 13}},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, tokens)
+	}
+	if parser.Position != 13 {
+		t.Fatalf("Expected position 13, but %d", parser.Position)
+	}
+
+	parser.Aliases = map[string]string{"bad": `echo "x`}
+	parser.Tolerant = true
+	if _, err := parser.Parse(`bad arg`); err != nil {
+		t.Fatal(err)
+	}
+	if len(parser.Diagnostics) != 1 || parser.Diagnostics[0].Span != (Span{0, 7}) {
+		t.Fatalf("Expected a diagnostic at 0-7, but %v", parser.Diagnostics)
+	}
+}
+
+func TestAliasesScript(t *testing.T) {
+	parser := NewParser()
+	parser.Aliases = map[string]string{
+		"ll":    "ls -la",
+		"sudo":  "sudo ",
+		"maybe": "if true; then",
+		"bad":   `echo "x`,
+	}
+	var tests = []struct {
+		script string
+		want   string
+	}{
+		{`ll; ll | sudo ll`, `[ls -la]; [ls -la] | [sudo ls -la];`},
+		{`X=1 ll a`, `[=X=1 ls -la a];`},
+		{`if ll; then echo ll; fi`, `if [ls -la]; then [echo ll]; fi;`},
+		{`maybe ll; fi`, `if [true]; then [ls -la]; fi;`},
+	}
+	for _, test := range tests {
+		list, err := parser.ParseScript(test.script)
+		if err != nil {
+			t.Fatalf("%q: %v", test.script, err)
+		}
+		if got := dump(list); got != test.want {
+			t.Fatalf("%q: Expected %s, but %s", test.script, test.want, got)
+		}
+	}
+
+	list, err := parser.ParseScript(`x; sudo ll`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := list.Items[1].Pipelines[0].Cmds[0].(*SimpleCommand).Args
+	if args[2].Raw != "-la" || args[2].Span != (Span{8, 10}) {
+		t.Fatalf("Expected -la at 8-10, but %q at %v", args[2].Raw, args[2].Span)
+	}
+
+	_, err = parser.ParseScript(`x; bad`)
+	if e, ok := err.(*SyntaxError); !ok || e.Span != (Span{3, 6}) {
+		t.Fatalf("Expected a syntax error at 3-6, but %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package shellwords
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var errUnterminatedANSIC = errors.New("unterminated $'...' string")
+
+// decodeANSIC decodes the body of $'...' starting at line[off], just after
+// the opening quote. It returns the decoded string and the offset just
+// after the closing quote. If the quote is never closed, it decodes up to
+// the end of line and returns errUnterminatedANSIC.
+func decodeANSIC(line string, off int) (string, int, error) {
+	var b strings.Builder
+	i := off
+	for i < len(line) {
+		c := line[i]
+		if c == '\'' {
+			return b.String(), i + 1, nil
+		}
+		if c != '\\' || i+1 == len(line) {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		i++
+		c = line[i]
+		i++
+		switch c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'e', 'E':
+			b.WriteByte(0x1b)
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '\\', '\'', '"', '?':
+			b.WriteByte(c)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := digits(line[i-1:], 3, 8)
+			v, _ := strconv.ParseUint(line[i-1:i-1+n], 8, 16)
+			b.WriteByte(byte(v))
+			i += n - 1
+		case 'x', 'u', 'U':
+			max := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+			n := digits(line[i:], max, 16)
+			if n == 0 {
+				b.WriteByte('\\')
+				b.WriteByte(c)
+				break
+			}
+			v, _ := strconv.ParseUint(line[i:i+n], 16, 32)
+			if c == 'x' {
+				b.WriteByte(byte(v))
+			} else if utf8.ValidRune(rune(v)) {
+				b.WriteRune(rune(v))
+			} else {
+				b.WriteRune(utf8.RuneError)
+			}
+			i += n
+		case 'c':
+			if i == len(line) {
+				b.WriteString(`\c`)
+				break
+			}
+			if line[i] == '?' {
+				b.WriteByte(0x7f)
+			} else {
+				b.WriteByte(line[i] & 0x1f)
+			}
+			i++
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), i, errUnterminatedANSIC
+}
+
+// digits counts the leading digits of s in the given base, up to max.
+func digits(s string, max, base int) int {
+	n := 0
+	for n < len(s) && n < max {
+		c := s[n]
+		switch {
+		case '0' <= c && c <= '7':
+		case base > 8 && '8' <= c && c <= '9':
+		case base == 16 && ('a' <= c && c <= 'f' || 'A' <= c && c <= 'F'):
+		default:
+			return n
+		}
+		n++
+	}
+	return n
+}
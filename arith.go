@@ -0,0 +1,516 @@
+package shellwords
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EvalArith evaluates the arithmetic expression expr the way the shell
+// does for $((expr)): with 64-bit signed integers and the operators of C.
+// Variables are read with Getenv and assigned with Setenv. Nothing is
+// ever run to evaluate it.
+func (p *Parser) EvalArith(expr string) (int64, error) {
+	a := &arith{p: p, vars: map[string]string{}}
+	return a.eval(expr, 0)
+}
+
+type arithToken struct {
+	op   string // operator, or "" for numbers and names
+	num  int64
+	name string
+}
+
+type arith struct {
+	p      *Parser
+	vars   map[string]string
+	tokens []arithToken
+	pos    int
+	noeval int
+}
+
+const maxArithDepth = 64
+
+var arithOps = []string{
+	"<<=", ">>=", "**", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||", "++", "--",
+	"*=", "/=", "%=", "+=", "-=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "<", ">", "&", "^", "|", "!", "~", "?", ":", "=", ",", "(", ")",
+}
+
+func (a *arith) eval(expr string, depth int) (int64, error) {
+	if depth > maxArithDepth {
+		return 0, errors.New("expression recursion level exceeded")
+	}
+	tokens, err := a.tokenize(expr)
+	if err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+	saved, savedPos := a.tokens, a.pos
+	a.tokens, a.pos = tokens, 0
+	defer func() { a.tokens, a.pos = saved, savedPos }()
+
+	v, err := a.comma(depth)
+	if err != nil {
+		return 0, err
+	}
+	if a.pos < len(a.tokens) {
+		return 0, fmt.Errorf("syntax error in expression (error token is %q)", a.tokens[a.pos].String())
+	}
+	return v, nil
+}
+
+func (t arithToken) String() string {
+	switch {
+	case t.op != "":
+		return t.op
+	case t.name != "":
+		return t.name
+	}
+	return strconv.FormatInt(t.num, 10)
+}
+
+func (a *arith) tokenize(expr string) ([]arithToken, error) {
+	var tokens []arithToken
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case isSpace(rune(c)):
+			i++
+		case '0' <= c && c <= '9':
+			j := i
+			for j < len(expr) && (isNameChar(expr[j]) || expr[j] == '#' || expr[j] == '@') {
+				j++
+			}
+			n, err := parseArithNumber(expr[i:j])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, arithToken{num: n})
+			i = j
+		case c == '$' || isNameStart(c):
+			j := i
+			if c == '$' {
+				j++
+			}
+			braced := j < len(expr) && expr[j] == '{'
+			if braced {
+				j++
+			}
+			k := j
+			for k < len(expr) && isNameChar(expr[k]) {
+				k++
+			}
+			if k == j || !isNameStart(expr[j]) && !(c == '$' && isDigits(expr[j:k])) {
+				return nil, fmt.Errorf("syntax error: operand expected (error token is %q)", expr[i:])
+			}
+			name := expr[j:k]
+			if braced {
+				if k == len(expr) || expr[k] != '}' {
+					return nil, errBadSubstitution
+				}
+				k++
+			}
+			tokens = append(tokens, arithToken{name: name})
+			i = k
+		default:
+			op := ""
+			for _, o := range arithOps {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("syntax error: invalid arithmetic operator (error token is %q)", expr[i:])
+			}
+			tokens = append(tokens, arithToken{op: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// parseArithNumber parses decimal, 0x hexadecimal, 0 octal and base#n
+// numbers.
+func parseArithNumber(s string) (int64, error) {
+	base := 10
+	digits := s
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		b, err := strconv.Atoi(s[:i])
+		if err != nil || b < 2 || b > 64 {
+			return 0, fmt.Errorf("invalid arithmetic base (error token is %q)", s)
+		}
+		base, digits = b, s[i+1:]
+	} else if len(s) > 1 && (s[1] == 'x' || s[1] == 'X') && s[0] == '0' {
+		base, digits = 16, s[2:]
+	} else if len(s) > 1 && s[0] == '0' {
+		base, digits = 8, s[1:]
+	}
+	if digits == "" {
+		return 0, fmt.Errorf("invalid number (error token is %q)", s)
+	}
+	var n int64
+	for i := 0; i < len(digits); i++ {
+		c := digits[i]
+		var d int
+		switch {
+		case '0' <= c && c <= '9':
+			d = int(c - '0')
+		case 'a' <= c && c <= 'z':
+			d = int(c-'a') + 10
+		case 'A' <= c && c <= 'Z':
+			d = int(c-'A') + 10
+			if base > 36 {
+				d += 26
+			}
+		case c == '@':
+			d = 62
+		case c == '_':
+			d = 63
+		default:
+			d = 64
+		}
+		if d >= base {
+			return 0, fmt.Errorf("value too great for base (error token is %q)", s)
+		}
+		n = n*int64(base) + int64(d)
+	}
+	return n, nil
+}
+
+func (a *arith) peek() arithToken {
+	if a.pos < len(a.tokens) {
+		return a.tokens[a.pos]
+	}
+	return arithToken{op: "end"}
+}
+
+func (a *arith) accept(ops ...string) string {
+	t := a.peek()
+	for _, op := range ops {
+		if t.op == op {
+			a.pos++
+			return op
+		}
+	}
+	return ""
+}
+
+func (a *arith) get(name string, depth int) (int64, error) {
+	value, ok := a.vars[name]
+	if !ok {
+		value = a.p.getenv(name)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if n, err := parseArithNumber(value); err == nil {
+		return n, nil
+	}
+	return a.eval(value, depth+1)
+}
+
+func (a *arith) set(name string, v int64) error {
+	if a.noeval > 0 {
+		return nil
+	}
+	if a.p.Setenv == nil {
+		return fmt.Errorf("cannot assign to %s: Setenv is nil", name)
+	}
+	value := strconv.FormatInt(v, 10)
+	if err := a.p.Setenv(name, value); err != nil {
+		return err
+	}
+	a.vars[name] = value
+	return nil
+}
+
+func (a *arith) comma(depth int) (int64, error) {
+	v, err := a.assign(depth)
+	for err == nil && a.accept(",") != "" {
+		v, err = a.assign(depth)
+	}
+	return v, err
+}
+
+func (a *arith) assign(depth int) (int64, error) {
+	if t := a.peek(); t.name != "" && a.pos+1 < len(a.tokens) {
+		op := a.tokens[a.pos+1].op
+		if op == "=" || len(op) >= 2 && strings.HasSuffix(op, "=") && op != "==" && op != "!=" && op != "<=" && op != ">=" {
+			a.pos += 2
+			v, err := a.assign(depth)
+			if err != nil {
+				return 0, err
+			}
+			if op != "=" {
+				old, err := a.get(t.name, depth)
+				if err != nil {
+					return 0, err
+				}
+				if v, err = a.binary(strings.TrimSuffix(op, "="), old, v); err != nil {
+					return 0, err
+				}
+			}
+			return v, a.set(t.name, v)
+		}
+	}
+	return a.ternary(depth)
+}
+
+func (a *arith) ternary(depth int) (int64, error) {
+	cond, err := a.level(0, depth)
+	if err != nil || a.accept("?") == "" {
+		return cond, err
+	}
+	if cond == 0 {
+		a.noeval++
+	}
+	v1, err := a.comma(depth)
+	if cond == 0 {
+		a.noeval--
+	}
+	if err != nil {
+		return 0, err
+	}
+	if a.accept(":") == "" {
+		return 0, errors.New("syntax error: ':' expected for conditional expression")
+	}
+	if cond != 0 {
+		a.noeval++
+	}
+	v2, err := a.ternary(depth)
+	if cond != 0 {
+		a.noeval--
+	}
+	if err != nil {
+		return 0, err
+	}
+	if cond != 0 {
+		return v1, nil
+	}
+	return v2, nil
+}
+
+// Binary operators from the lowest precedence to the highest.
+var arithLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (a *arith) level(n int, depth int) (int64, error) {
+	if n == len(arithLevels) {
+		return a.power(depth)
+	}
+	v, err := a.level(n+1, depth)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := a.accept(arithLevels[n]...)
+		if op == "" {
+			return v, nil
+		}
+		short := op == "&&" && v == 0 || op == "||" && v != 0
+		if short {
+			a.noeval++
+		}
+		rhs, err := a.level(n+1, depth)
+		if short {
+			a.noeval--
+		}
+		if err != nil {
+			return 0, err
+		}
+		if v, err = a.binary(op, v, rhs); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (a *arith) power(depth int) (int64, error) {
+	v, err := a.unary(depth)
+	if err != nil || a.accept("**") == "" {
+		return v, err
+	}
+	rhs, err := a.power(depth)
+	if err != nil {
+		return 0, err
+	}
+	return a.binary("**", v, rhs)
+}
+
+func (a *arith) binary(op string, x, y int64) (int64, error) {
+	b2i := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "||":
+		return b2i(x != 0 || y != 0), nil
+	case "&&":
+		return b2i(x != 0 && y != 0), nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	case "&":
+		return x & y, nil
+	case "==":
+		return b2i(x == y), nil
+	case "!=":
+		return b2i(x != y), nil
+	case "<":
+		return b2i(x < y), nil
+	case "<=":
+		return b2i(x <= y), nil
+	case ">":
+		return b2i(x > y), nil
+	case ">=":
+		return b2i(x >= y), nil
+	case "<<":
+		return x << (uint64(y) & 63), nil
+	case ">>":
+		return x >> (uint64(y) & 63), nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			if a.noeval > 0 {
+				return 0, nil
+			}
+			return 0, errors.New("division by 0")
+		}
+		if op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "**":
+		if y < 0 {
+			return 0, errors.New("exponent less than 0")
+		}
+		r := int64(1)
+		for ; y > 0; y >>= 1 {
+			if y&1 == 1 {
+				r *= x
+			}
+			x *= x
+		}
+		return r, nil
+	}
+	return 0, fmt.Errorf("unknown operator %s", op)
+}
+
+func (a *arith) unary(depth int) (int64, error) {
+	switch op := a.accept("!", "~", "+", "-", "++", "--"); op {
+	case "":
+		return a.postfix(depth)
+	case "++", "--":
+		t := a.peek()
+		if t.name == "" {
+			return 0, fmt.Errorf("syntax error: operand expected (error token is %q)", t.String())
+		}
+		a.pos++
+		v, err := a.get(t.name, depth)
+		if err != nil {
+			return 0, err
+		}
+		if op == "++" {
+			v++
+		} else {
+			v--
+		}
+		return v, a.set(t.name, v)
+	default:
+		v, err := a.unary(depth)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "!":
+			if v == 0 {
+				return 1, nil
+			}
+			return 0, nil
+		case "~":
+			return ^v, nil
+		case "-":
+			return -v, nil
+		}
+		return v, nil
+	}
+}
+
+func (a *arith) postfix(depth int) (int64, error) {
+	t := a.peek()
+	switch {
+	case t.op == "(":
+		a.pos++
+		v, err := a.comma(depth)
+		if err != nil {
+			return 0, err
+		}
+		if a.accept(")") == "" {
+			return 0, errors.New("syntax error: missing ')'")
+		}
+		return v, nil
+	case t.name != "":
+		a.pos++
+		v, err := a.get(t.name, depth)
+		if err != nil {
+			return 0, err
+		}
+		if op := a.accept("++", "--"); op != "" {
+			n := v + 1
+			if op == "--" {
+				n = v - 1
+			}
+			return v, a.set(t.name, n)
+		}
+		return v, nil
+	case t.op == "":
+		a.pos++
+		return t.num, nil
+	}
+	return 0, fmt.Errorf("syntax error: operand expected (error token is %q)", t.String())
+}
+
+// arithEnd returns the offset just after the "))" closing the arithmetic
+// expansion whose "$((" starts at line[off], or -1 if there is none.
+func arithEnd(line string, off int) int {
+	depth := 0
+	for i := off + 3; i < len(line); i++ {
+		switch line[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			} else if i+1 < len(line) && line[i+1] == ')' {
+				return i + 2
+			} else {
+				return -1
+			}
+		}
+	}
+	return -1
+}
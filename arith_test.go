@@ -0,0 +1,116 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvalArith(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected int64
+	}{
+		{"1+2", 3},
+		{" 7 / 2 * 2 + 7 % 2 ", 7},
+		{"-7 / 2, -7 % 2", -1},
+		{"2**10 - 1", 1023},
+		{"-2**2", 4},
+		{"2**3**2", 512},
+		{"1 << 62 << 1", -9223372036854775808},
+		{"9223372036854775807 + 1", -9223372036854775808},
+		{"0x1F + 010 + 2#101 + 36#z + 64#_", 31 + 8 + 5 + 35 + 63},
+		{"!0 + !5 + ~0", 0},
+		{"3 > 2 && 2 >= 2 && 1 < 2 && 1 <= 1 && 1 == 1 && 1 != 2", 1},
+		{"6 & 3 | 8 ^ 1", 11},
+		{"0 && 1/0", 0},
+		{"1 || 1/0", 1},
+		{"1 ? 2 : 1/0", 2},
+		{"0 ? 1/0 : 3", 3},
+		{"(1 + 2) * 3", 9},
+		{"X * 2 + Y", 21},
+		{"$X + ${X} + Z", 20 + 10},
+		{"EMPTY + 1", 1},
+		{"", 0},
+	}
+	parser := NewParser()
+	parser.Getenv = func(k string) string { return map[string]string{"X": "10", "Y": "1", "Z": "X"}[k] }
+	for _, tt := range tests {
+		v, err := parser.EvalArith(tt.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.expr, err)
+		}
+		if v != tt.expected {
+			t.Fatalf("Expected %d for %q, but %d", tt.expected, tt.expr, v)
+		}
+	}
+
+	for _, expr := range []string{"1/0", "1 % 0", "2 ** -1", "1 +", "(1", "1 ? 2", "08", "1 2", "x = 1", "@"} {
+		if _, err := parser.EvalArith(expr); err == nil {
+			t.Fatalf("%q: Should be an error", expr)
+		}
+	}
+}
+
+func TestEvalArithAssign(t *testing.T) {
+	vars := map[string]string{"i": "5"}
+	parser := NewParser()
+	parser.Getenv = func(k string) string { return vars[k] }
+	parser.Setenv = func(k, v string) error {
+		vars[k] = v
+		return nil
+	}
+	tests := []struct {
+		expr     string
+		expected int64
+		i        string
+	}{
+		{"i++", 5, "6"},
+		{"++i", 7, "7"},
+		{"i--, i", 6, "6"},
+		{"i += 4", 10, "10"},
+		{"i <<= 2", 40, "40"},
+		{"j = i = 3", 3, "3"},
+		{"0 && (i = 100)", 0, "3"},
+		{"i = 1 ? 9 : 8", 9, "9"},
+	}
+	for _, tt := range tests {
+		v, err := parser.EvalArith(tt.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.expr, err)
+		}
+		if v != tt.expected || vars["i"] != tt.i {
+			t.Fatalf("Expected %d and i=%s for %q, but %d and i=%s", tt.expected, tt.i, tt.expr, v, vars["i"])
+		}
+	}
+	if vars["j"] != "3" {
+		t.Fatalf("Expected j=3, but %q", vars["j"])
+	}
+}
+
+func TestParseArith(t *testing.T) {
+	for _, mode := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+		parser := NewParser()
+		parser.Escape = mode
+		parser.ParseArith = true
+		parser.Getenv = func(k string) string { return map[string]string{"N": "4"}[k] }
+		args, err := parser.Parse(`echo $((1+2)) x$(( (N + 1) * 2 ))y "$((N*N))" '$((1+1))'`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"echo", "3", "x10y", "16", "$((1+1))"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Fatalf("Expected %#v, but %#v:", expected, args)
+		}
+
+		if _, err := parser.Parse(`echo $((1/0))`); err == nil {
+			t.Fatal("Should be an error")
+		}
+		if _, err := parser.Parse(`echo $((1+2`); err == nil {
+			t.Fatal("Should be an error")
+		}
+	}
+
+	if _, err := Parse(`echo $((1+2))`); err == nil {
+		t.Fatal("Should be an error")
+	}
+}
@@ -0,0 +1,145 @@
+package shellwords
+
+// List is a sequence of and-or lists separated by ';', '&' or newlines.
+type List struct {
+	Items []*AndOr
+	Span  Span
+}
+
+// AndOr is pipelines joined by && and ||.
+type AndOr struct {
+	Pipelines []*Pipeline
+	Ops       []string // "&&" or "||" between each pair of pipelines
+	// Background is true if the list was terminated by '&'.
+	Background bool
+	Span       Span
+}
+
+// Pipeline is commands joined by '|'.
+type Pipeline struct {
+	// Bang is true if the pipeline starts with '!'.
+	Bang bool
+	Cmds []CommandNode
+	Span Span
+}
+
+// CommandNode is one of *SimpleCommand, *Subshell, *BraceGroup, *IfClause,
+// *CaseClause, *ForClause, *WhileClause or *FuncDecl.
+type CommandNode interface {
+	// Pos returns the span of the command in the script.
+	Pos() Span
+}
+
+// SimpleCommand is a command with its arguments, like FOO=1 cmd arg >out.
+type SimpleCommand struct {
+	Assigns []*Word
+	Args    []*Word
+	Redirs  []*Redirect
+	Span    Span
+}
+
+// Subshell is ( list ).
+type Subshell struct {
+	Body   *List
+	Redirs []*Redirect
+	Span   Span
+}
+
+// BraceGroup is { list; }.
+type BraceGroup struct {
+	Body   *List
+	Redirs []*Redirect
+	Span   Span
+}
+
+// IfClause is if list; then list; [elif list; then list;]... [else list;] fi.
+type IfClause struct {
+	Cond   *List
+	Then   *List
+	Elifs  []*Elif
+	Else   *List // nil if there is no else
+	Redirs []*Redirect
+	Span   Span
+}
+
+// Elif is the elif part of an IfClause.
+type Elif struct {
+	Cond *List
+	Then *List
+	Span Span
+}
+
+// CaseClause is case word in [(]pattern[|pattern]...) list;; ... esac.
+type CaseClause struct {
+	Word   *Word
+	Items  []*CaseItem
+	Redirs []*Redirect
+	Span   Span
+}
+
+// CaseItem is the patterns and the list of one branch of a CaseClause.
+type CaseItem struct {
+	Patterns []*Word
+	Body     *List
+	Span     Span
+}
+
+// ForClause is for name [in word...]; do list; done.
+type ForClause struct {
+	Name *Word
+	// In is false if the in part was left out, in which case the loop
+	// goes over the positional parameters.
+	In     bool
+	Items  []*Word
+	Body   *List
+	Redirs []*Redirect
+	Span   Span
+}
+
+// WhileClause is while list; do list; done, or until if Until is true.
+type WhileClause struct {
+	Until  bool
+	Cond   *List
+	Body   *List
+	Redirs []*Redirect
+	Span   Span
+}
+
+// FuncDecl is name() compound-command.
+type FuncDecl struct {
+	Name *Word
+	Body CommandNode
+	Span Span
+}
+
+func (c *SimpleCommand) Pos() Span { return c.Span }
+func (c *Subshell) Pos() Span      { return c.Span }
+func (c *BraceGroup) Pos() Span    { return c.Span }
+func (c *IfClause) Pos() Span      { return c.Span }
+func (c *CaseClause) Pos() Span    { return c.Span }
+func (c *ForClause) Pos() Span     { return c.Span }
+func (c *WhileClause) Pos() Span   { return c.Span }
+func (c *FuncDecl) Pos() Span      { return c.Span }
+
+// Word is a word of a script as it is written, with its quotes. Use
+// Parser.ExpandWord to get its value.
+type Word struct {
+	Raw  string
+	Span Span
+}
+
+// Redirect is a redirection such as 2>&1, >>out.txt or <<EOF.
+type Redirect struct {
+	// N is the file descriptor written before Op, or -1 if there is none.
+	N      int
+	Op     string
+	Target *Word
+
+	// For << and <<-, Heredoc is the here-document and HeredocQuoted
+	// tells if the delimiter was quoted, in which case the here-document
+	// is not expanded.
+	Heredoc       string
+	HeredocQuoted bool
+
+	Span Span
+}
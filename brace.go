@@ -0,0 +1,179 @@
+package shellwords
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxBraceWords is the most words one word expands to.
+const maxBraceWords = 1 << 16
+
+// expandBrace does brace expansion on the unquoted braces of w like bash,
+// returning the words it expands to in order. It returns false if there
+// would be more than maxBraceWords of them.
+func expandBrace(w word) ([]word, bool) {
+	for i := 0; i < w.len(); i++ {
+		if w.s[i] != '{' || w.mask[i] != unquoted || i > 0 && w.s[i-1] == '$' && w.mask[i-1] == unquoted {
+			continue
+		}
+
+		depth, end := 0, -1
+		var commas []int
+	scan:
+		for j := i; j < w.len(); j++ {
+			if w.mask[j] != unquoted {
+				continue
+			}
+			switch w.s[j] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = j
+					break scan
+				}
+			case ',':
+				if depth == 1 {
+					commas = append(commas, j)
+				}
+			}
+		}
+		if end < 0 {
+			break
+		}
+
+		var alts []word
+		if len(commas) > 0 {
+			from := i + 1
+			for _, comma := range append(commas, end) {
+				alts = append(alts, w.slice(from, comma))
+				from = comma + 1
+			}
+		} else if isUnquoted(w.mask[i+1 : end]) {
+			seq, ok := braceSequence(w.s[i+1 : end])
+			if !ok {
+				continue
+			}
+			for _, s := range seq {
+				var alt word
+				alt.add(s, unquoted)
+				alts = append(alts, alt)
+			}
+		} else {
+			continue
+		}
+
+		pre := w.slice(0, i)
+		posts, ok := expandBrace(w.slice(end+1, w.len()))
+		if !ok {
+			return nil, false
+		}
+		var words []word
+		for _, alt := range alts {
+			as, ok := expandBrace(alt)
+			if !ok || len(as) > (maxBraceWords-len(words))/len(posts) {
+				return nil, false
+			}
+			for _, a := range as {
+				for _, post := range posts {
+					r := pre.slice(0, pre.len())
+					r.append(a)
+					r.append(post)
+					words = append(words, r)
+				}
+			}
+		}
+		return words, true
+	}
+	return []word{w}, true
+}
+
+// maxBraceSequence is the most items a sequence expands to. A longer one
+// is left as it is.
+const maxBraceSequence = 1 << 16
+
+// braceSequence expands the body of {x..y} or {x..y..incr}, where x and y
+// are both integers or both single characters.
+func braceSequence(s string) ([]string, bool) {
+	parts := strings.Split(s, "..")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, false
+	}
+	// The sizes are unsigned, so that neither the distance between any
+	// two int64s nor the steps up to it overflow.
+	step := uint64(1)
+	if len(parts) == 3 {
+		n, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		if n < 0 {
+			step = -uint64(n)
+		} else if n != 0 {
+			step = uint64(n)
+		}
+	}
+
+	from, err1 := strconv.ParseInt(parts[0], 10, 64)
+	to, err2 := strconv.ParseInt(parts[1], 10, 64)
+	chars := false
+	if err1 != nil || err2 != nil {
+		if len(parts[0]) != 1 || len(parts[1]) != 1 || err1 == nil || err2 == nil {
+			return nil, false
+		}
+		from, to = int64(parts[0][0]), int64(parts[1][0])
+		chars = true
+	}
+
+	width := 0
+	if !chars && (isZeroPadded(parts[0]) || isZeroPadded(parts[1])) {
+		width = len(parts[0])
+		if len(parts[1]) > width {
+			width = len(parts[1])
+		}
+	}
+
+	down := from > to
+	dist := uint64(to) - uint64(from)
+	if down {
+		dist = uint64(from) - uint64(to)
+	}
+	if dist/step >= maxBraceSequence {
+		return nil, false
+	}
+	seq := make([]string, 0, dist/step+1)
+	for i, u := uint64(0), uint64(from); i <= dist/step; i++ {
+		if i > 0 && down {
+			u -= step
+		} else if i > 0 {
+			u += step
+		}
+		n := int64(u)
+		switch {
+		case chars:
+			seq = append(seq, string(rune(n)))
+		case width > 0:
+			s := strings.TrimPrefix(strconv.FormatInt(n, 10), "-")
+			pad := width - len(s)
+			if n < 0 {
+				pad--
+			}
+			if pad > 0 {
+				s = strings.Repeat("0", pad) + s
+			}
+			if n < 0 {
+				s = "-" + s
+			}
+			seq = append(seq, s)
+		default:
+			seq = append(seq, strconv.FormatInt(n, 10))
+		}
+	}
+	return seq, true
+}
+
+func isZeroPadded(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
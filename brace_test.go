@@ -0,0 +1,79 @@
+package shellwords
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBrace(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`mkdir -p build/{debug,release}/{bin,lib}`, []string{"mkdir", "-p", "build/debug/bin", "build/debug/lib", "build/release/bin", "build/release/lib"}},
+		{`a{b,c{d,e}f}g`, []string{"abg", "acdfg", "acefg"}},
+		{`{1..5} {5..1..2} {1..10..3}`, []string{"1", "2", "3", "4", "5", "5", "3", "1", "1", "4", "7", "10"}},
+		{`{01..10..3} {-2..1} {-05..5..5}`, []string{"01", "04", "07", "10", "-2", "-1", "0", "1", "-05", "000", "005"}},
+		{`{a..e..2} {C..A}`, []string{"a", "c", "e", "C", "B", "A"}},
+		{`x{a,} {a,}`, []string{"xa", "x", "a"}},
+		{`'{a,b}' "{a,b}" \{a,b} {a\,b} {a,'b,c'}`, []string{"{a,b}", "{a,b}", "{a,b}", "{a,b}", "a", "b,c"}},
+		{`{a} {} {a,b {1..x} a{b}c{d,e}`, []string{"{a}", "{}", "{a,b", "{1..x}", "a{b}cd", "a{b}ce"}},
+		{`"{"a,b} {"a b",c}`, []string{"{a,b}", "a b", "c"}},
+		{`{9223372036854775806..9223372036854775807}`, []string{"9223372036854775806", "9223372036854775807"}},
+		{`{-9223372036854775808..9223372036854775807..-9223372036854775808}`, []string{"-9223372036854775808", "0"}},
+		{`{-09223372036854775808..-9223372036854775807}`, []string{"-09223372036854775808", "-09223372036854775807"}},
+		{`{1..100000} {0..9223372036854775807}`, []string{"{1..100000}", "{0..9223372036854775807}"}},
+	}
+	for _, mode := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+		for _, tt := range tests {
+			parser := NewParser()
+			parser.Escape = mode
+			parser.ParseBrace = true
+			args, err := parser.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("%q: %v", tt.line, err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Fatalf("Expected %#v for %q, but %#v:", tt.expected, tt.line, args)
+			}
+		}
+	}
+}
+
+func TestBraceTooMany(t *testing.T) {
+	for _, line := range []string{`{1..60000}{1..60000}`, strings.Repeat(`{a,b}`, 30), `x {1..300}{a,b}{1..300}`} {
+		parser := NewParser()
+		parser.ParseBrace = true
+		if _, err := parser.Parse(line); err == nil {
+			t.Fatalf("%q: Should be an error", line)
+		}
+	}
+	parser := NewParser()
+	parser.ParseBrace = true
+	args, err := parser.Parse(strings.Repeat(`{a,b}`, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1<<16 {
+		t.Fatalf("Expected %d words, but %d", 1<<16, len(args))
+	}
+}
+
+func TestBraceBeforeEnv(t *testing.T) {
+	for _, mode := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+		parser := NewParser()
+		parser.Escape = mode
+		parser.ParseBrace = true
+		parser.ParseEnv = true
+		parser.Getenv = func(k string) string { return map[string]string{"A": "x", "B": "y,z", "C": "{1,2}"}[k] }
+		args, err := parser.Parse(`{$A,$B} ${A}{1,2} $C`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"x", "y,z", "x1", "x2", "{1,2}"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Fatalf("Expected %#v, but %#v:", expected, args)
+		}
+	}
+}
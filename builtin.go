@@ -0,0 +1,766 @@
+package shellwords
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Builtin is a command which a Runner runs in process. It returns the exit
+// status of the command.
+type Builtin func(ctx context.Context, bc *BuiltinContext) int
+
+// BuiltinContext is what a Builtin runs with.
+type BuiltinContext struct {
+	// Args are the words of the command, with the name of the builtin
+	// first.
+	Args []string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Parser is the parser of the Runner. Changing its Dir or Env changes
+	// them for the commands which follow.
+	Parser *Parser
+
+	// Status is the exit status of the last pipeline, like $?.
+	Status int
+
+	run *run
+}
+
+// Exit makes the Runner stop after this command with status, which it
+// returns. In a pipeline it only ends the builtin.
+func (bc *BuiltinContext) Exit(status int) int {
+	if bc.run != nil {
+		bc.run.exited = true
+	}
+	return status
+}
+
+// DefaultBuiltins are the builtins of a Runner which has none set. export
+// and unset change Env, and with Getenv set they need Setenv, which they
+// call too. cd keeps PWD and OLDPWD only in an Env which is not nil, so
+// cd - needs one.
+var DefaultBuiltins = map[string]Builtin{
+	"cd":     builtinCd,
+	"echo":   builtinEcho,
+	"exit":   builtinExit,
+	"export": builtinExport,
+	"false":  func(context.Context, *BuiltinContext) int { return 1 },
+	"printf": builtinPrintf,
+	"test":   builtinTest,
+	"true":   func(context.Context, *BuiltinContext) int { return 0 },
+	"unset":  builtinUnset,
+	"[":      builtinTest,
+}
+
+func (bc *BuiltinContext) errorf(status int, format string, a ...interface{}) int {
+	fmt.Fprintf(bc.Stderr, "%s: %s\n", bc.Args[0], fmt.Sprintf(format, a...))
+	return status
+}
+
+// setenv sets name to value for the expansions and commands which follow.
+// getenv reads Getenv first, so if it is set, name is set with Setenv too.
+// The commands get Env, which is filled from os.Environ() first if it is
+// nil and fill is true, and left nil otherwise. Env is replaced rather than
+// changed in place, so copies of p keep theirs.
+func (p *Parser) setenv(name, value string, fill bool) error {
+	if p.Getenv != nil {
+		if p.Setenv == nil {
+			return fmt.Errorf("cannot set %s: Setenv is nil", name)
+		}
+		if err := p.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+	if p.Env != nil || fill {
+		p.Env = mergeEnv(p.Env, []Assignment{{Name: name, Value: value}})
+	}
+	return nil
+}
+
+// unsetenv removes name like setenv sets it. With Getenv it is set empty,
+// as there is no way to remove it.
+func (p *Parser) unsetenv(name string) error {
+	if p.Getenv != nil {
+		if p.Setenv == nil {
+			return fmt.Errorf("cannot unset %s: Setenv is nil", name)
+		}
+		if err := p.Setenv(name, ""); err != nil {
+			return err
+		}
+	}
+	env := p.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	p.Env = []string{}
+	for _, kv := range env {
+		if envKey(envName(kv)) != envKey(name) {
+			p.Env = append(p.Env, kv)
+		}
+	}
+	return nil
+}
+
+func builtinCd(ctx context.Context, bc *BuiltinContext) int {
+	p := bc.Parser
+	var dir string
+	switch len(bc.Args) {
+	case 1:
+		if dir = p.getenv("HOME"); dir == "" {
+			return bc.errorf(1, "HOME not set")
+		}
+	case 2:
+		if dir = bc.Args[1]; dir == "-" {
+			if dir = p.getenv("OLDPWD"); dir == "" {
+				return bc.errorf(1, "OLDPWD not set")
+			}
+			fmt.Fprintln(bc.Stdout, dir)
+		}
+	default:
+		return bc.errorf(1, "too many arguments")
+	}
+
+	old := p.Dir
+	if old == "" {
+		var err error
+		if old, err = os.Getwd(); err != nil {
+			return bc.errorf(1, "%v", err)
+		}
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(old, dir)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return bc.errorf(1, "%v", err)
+	}
+	if !fi.IsDir() {
+		return bc.errorf(1, "%s: Not a directory", bc.Args[1])
+	}
+	p.Dir = filepath.Clean(dir)
+	// With a nil Env the commands get the environment of this process,
+	// which is not copied just for PWD and OLDPWD.
+	if err := p.setenv("OLDPWD", old, false); err != nil {
+		return bc.errorf(1, "%v", err)
+	}
+	if err := p.setenv("PWD", p.Dir, false); err != nil {
+		return bc.errorf(1, "%v", err)
+	}
+	return 0
+}
+
+func builtinExport(ctx context.Context, bc *BuiltinContext) int {
+	p := bc.Parser
+	args := bc.Args[1:]
+	if len(args) > 0 && args[0] == "-p" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		env := p.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		env = append([]string(nil), env...)
+		sort.Strings(env)
+		for _, kv := range env {
+			name := envName(kv)
+			if isName(name) && len(name) < len(kv) {
+				fmt.Fprintf(bc.Stdout, "export %s=%s\n", name, Quote(kv[len(name)+1:]))
+			}
+		}
+		return 0
+	}
+
+	status := 0
+	for _, arg := range args {
+		name, value := arg, ""
+		eq := strings.IndexByte(arg, '=')
+		if eq >= 0 {
+			name, value = arg[:eq], arg[eq+1:]
+		}
+		if !isName(name) {
+			status = bc.errorf(1, "`%s': not a valid identifier", arg)
+			continue
+		}
+		// Every variable is in the environment already; export NAME has
+		// nothing to do.
+		if eq >= 0 {
+			if err := p.setenv(name, value, true); err != nil {
+				status = bc.errorf(1, "%v", err)
+			}
+		}
+	}
+	return status
+}
+
+func builtinUnset(ctx context.Context, bc *BuiltinContext) int {
+	args := bc.Args[1:]
+	if len(args) > 0 && args[0] == "-v" {
+		args = args[1:]
+	}
+	status := 0
+	for _, name := range args {
+		if !isName(name) {
+			status = bc.errorf(1, "`%s': not a valid identifier", name)
+			continue
+		}
+		if err := bc.Parser.unsetenv(name); err != nil {
+			status = bc.errorf(1, "%v", err)
+		}
+	}
+	return status
+}
+
+func builtinExit(ctx context.Context, bc *BuiltinContext) int {
+	switch len(bc.Args) {
+	case 1:
+		return bc.Exit(bc.Status)
+	case 2:
+		n, err := strconv.Atoi(bc.Args[1])
+		if err != nil {
+			return bc.Exit(bc.errorf(2, "%s: numeric argument required", bc.Args[1]))
+		}
+		return bc.Exit(n & 0xff)
+	}
+	return bc.errorf(1, "too many arguments")
+}
+
+func builtinEcho(ctx context.Context, bc *BuiltinContext) int {
+	args := bc.Args[1:]
+	newline, escapes := true, false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && strings.Trim(args[0][1:], "neE") == "" {
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'n':
+				newline = false
+			case 'e':
+				escapes = true
+			case 'E':
+				escapes = false
+			}
+		}
+		args = args[1:]
+	}
+
+	s := strings.Join(args, " ")
+	if escapes {
+		var stop bool
+		if s, stop = unescapeEcho(s); stop {
+			newline = false
+		}
+	}
+	if newline {
+		s += "\n"
+	}
+	if _, err := io.WriteString(bc.Stdout, s); err != nil {
+		return bc.errorf(1, "write error: %v", err)
+	}
+	return 0
+}
+
+// unescapeEcho decodes the escapes of s as echo -e and %b of printf do.
+// stop is true if s has \c, which ends the output.
+func unescapeEcho(s string) (_ string, stop bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		var t string
+		t, i, stop = unescape(s, i+1, true)
+		b.WriteString(t)
+		if stop {
+			break
+		}
+	}
+	return b.String(), stop
+}
+
+// unescape decodes the escape at s[i], just after a backslash, as echo -e
+// and printf do. If echo is true, octal escapes are \0nnn as for echo,
+// otherwise \nnn as in the format of printf. It returns the offset after
+// the escape and whether it is \c.
+func unescape(s string, i int, echo bool) (string, int, bool) {
+	c := s[i]
+	i++
+	switch c {
+	case 'a':
+		return "\a", i, false
+	case 'b':
+		return "\b", i, false
+	case 'e', 'E':
+		return "\x1b", i, false
+	case 'f':
+		return "\f", i, false
+	case 'n':
+		return "\n", i, false
+	case 'r':
+		return "\r", i, false
+	case 't':
+		return "\t", i, false
+	case 'v':
+		return "\v", i, false
+	case '\\':
+		return "\\", i, false
+	case 'c':
+		return "", i, true
+	case 'x':
+		n := digits(s[i:], 2, 16)
+		if n == 0 {
+			return `\x`, i, false
+		}
+		v, _ := strconv.ParseUint(s[i:i+n], 16, 8)
+		return string([]byte{byte(v)}), i + n, false
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		start := i - 1
+		if echo {
+			if c != '0' {
+				break
+			}
+			start = i
+		}
+		n := digits(s[start:], 3, 8)
+		v, _ := strconv.ParseUint("0"+s[start:start+n], 8, 16)
+		return string([]byte{byte(v)}), start + n, false
+	case '"', '\'':
+		if !echo {
+			return string(c), i, false
+		}
+	}
+	return "\\" + string(c), i, false
+}
+
+func builtinPrintf(ctx context.Context, bc *BuiltinContext) int {
+	if len(bc.Args) < 2 {
+		return bc.errorf(2, "usage: printf format [arguments]")
+	}
+	format, args := bc.Args[1], bc.Args[2:]
+	var b strings.Builder
+	status := 0
+	next := func() (string, bool) {
+		if len(args) == 0 {
+			return "", false
+		}
+		arg := args[0]
+		args = args[1:]
+		return arg, true
+	}
+
+out:
+	for {
+		used := len(args)
+		for i := 0; i < len(format); {
+			c := format[i]
+			if c == '\\' && i+1 < len(format) {
+				var t string
+				var stop bool
+				t, i, stop = unescape(format, i+1, false)
+				b.WriteString(t)
+				if stop {
+					break out
+				}
+				continue
+			}
+			if c != '%' {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+
+			// %[flags][width][.precision]verb
+			j := i + 1
+			for j < len(format) && strings.IndexByte("-+ #0", format[j]) >= 0 {
+				j++
+			}
+			spec := format[i:j]
+			for _, part := range []bool{true, false} {
+				if !part {
+					if j == len(format) || format[j] != '.' {
+						break
+					}
+					spec += "."
+					j++
+				}
+				if j < len(format) && format[j] == '*' {
+					arg, _ := next()
+					n, err := strconv.Atoi(arg)
+					if err != nil && arg != "" {
+						status = bc.errorf(1, "%s: invalid number", arg)
+					}
+					spec += strconv.Itoa(n)
+					j++
+					continue
+				}
+				k := j
+				for j < len(format) && '0' <= format[j] && format[j] <= '9' {
+					j++
+				}
+				spec += format[k:j]
+			}
+			if j == len(format) {
+				return bc.errorf(1, "%s: missing format character", format[i:])
+			}
+			verb := format[j]
+			i = j + 1
+
+			switch verb {
+			case '%':
+				b.WriteByte('%')
+			case 's':
+				arg, _ := next()
+				fmt.Fprintf(&b, spec+"s", arg)
+			case 'b':
+				arg, _ := next()
+				arg, stop := unescapeEcho(arg)
+				fmt.Fprintf(&b, spec+"s", arg)
+				if stop {
+					break out
+				}
+			case 'q':
+				arg, _ := next()
+				fmt.Fprintf(&b, spec+"s", POSIXQuoter{ANSIC: true}.Quote(arg))
+			case 'c':
+				if arg, _ := next(); arg != "" {
+					fmt.Fprintf(&b, spec+"s", arg[:1])
+				}
+			case 'd', 'i', 'o', 'u', 'x', 'X':
+				arg, _ := next()
+				n, err := printfInt(arg)
+				if err != nil {
+					status = bc.errorf(1, "%s: invalid number", arg)
+				}
+				switch verb {
+				case 'd', 'i':
+					fmt.Fprintf(&b, spec+"d", n)
+				case 'u':
+					fmt.Fprintf(&b, spec+"d", uint64(n))
+				default:
+					fmt.Fprintf(&b, spec+string(verb), uint64(n))
+				}
+			case 'e', 'E', 'f', 'F', 'g', 'G':
+				arg, _ := next()
+				f, err := strconv.ParseFloat(arg, 64)
+				if err != nil && arg != "" {
+					if n, err2 := printfInt(arg); err2 == nil {
+						f = float64(n)
+					} else {
+						status = bc.errorf(1, "%s: invalid number", arg)
+					}
+				}
+				fmt.Fprintf(&b, spec+string(verb), f)
+			default:
+				return bc.errorf(1, "%%%c: invalid format character", verb)
+			}
+		}
+		// The format is used again for the arguments left, if it took any.
+		if len(args) == 0 || len(args) == used {
+			break
+		}
+	}
+
+	if _, err := io.WriteString(bc.Stdout, b.String()); err != nil {
+		return bc.errorf(1, "write error: %v", err)
+	}
+	return status
+}
+
+// printfInt parses the argument of an integer conversion of printf. A
+// leading quote gives the code of the character after it.
+func printfInt(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if s[0] == '\'' || s[0] == '"' {
+		if len(s) == 1 {
+			return 0, nil
+		}
+		return int64([]rune(s[1:])[0]), nil
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		if u, err2 := strconv.ParseUint(s, 0, 64); err2 == nil {
+			return int64(u), nil
+		}
+	}
+	return n, err
+}
+
+func builtinTest(ctx context.Context, bc *BuiltinContext) int {
+	args := bc.Args[1:]
+	if bc.Args[0] == "[" {
+		if len(args) == 0 || args[len(args)-1] != "]" {
+			return bc.errorf(2, "missing `]'")
+		}
+		args = args[:len(args)-1]
+	}
+	t := &tester{p: bc.Parser, args: args}
+	ok, err := t.test()
+	if err != nil {
+		return bc.errorf(2, "%v", err)
+	}
+	if ok {
+		return 0
+	}
+	return 1
+}
+
+// tester evaluates the expressions of test.
+type tester struct {
+	p    *Parser
+	args []string
+	pos  int
+}
+
+var errTestArgument = errors.New("argument expected")
+
+func (t *tester) test() (bool, error) {
+	// POSIX decides by the number of arguments, so that strings like "!"
+	// or "-n" are operands when there is nothing else for them to be.
+	a := t.args
+	switch len(a) {
+	case 0:
+		return false, nil
+	case 1:
+		return a[0] != "", nil
+	case 2:
+		if a[0] == "!" {
+			return a[1] == "", nil
+		}
+		if isUnaryTest(a[0]) {
+			return t.unary(a[0], a[1])
+		}
+		return false, fmt.Errorf("%s: unary operator expected", a[0])
+	case 3:
+		if isBinaryTest(a[1]) {
+			return t.binary(a[0], a[1], a[2])
+		}
+		if a[0] == "!" {
+			ok, err := (&tester{p: t.p, args: a[1:]}).test()
+			return !ok, err
+		}
+		if a[0] == "(" && a[2] == ")" {
+			return a[1] != "", nil
+		}
+	case 4:
+		if a[0] == "!" {
+			ok, err := (&tester{p: t.p, args: a[1:]}).test()
+			return !ok, err
+		}
+		if a[0] == "(" && a[3] == ")" {
+			return (&tester{p: t.p, args: a[1:3]}).test()
+		}
+	}
+
+	ok, err := t.or()
+	if err == nil && t.pos < len(t.args) {
+		err = fmt.Errorf("%s: unexpected argument", t.args[t.pos])
+	}
+	return ok, err
+}
+
+func (t *tester) peek() string {
+	if t.pos < len(t.args) {
+		return t.args[t.pos]
+	}
+	return ""
+}
+
+func (t *tester) next() (string, error) {
+	if t.pos == len(t.args) {
+		return "", errTestArgument
+	}
+	t.pos++
+	return t.args[t.pos-1], nil
+}
+
+func (t *tester) or() (bool, error) {
+	ok, err := t.and()
+	for err == nil && t.peek() == "-o" {
+		t.pos++
+		var ok2 bool
+		ok2, err = t.and()
+		ok = ok || ok2
+	}
+	return ok, err
+}
+
+func (t *tester) and() (bool, error) {
+	ok, err := t.not()
+	for err == nil && t.peek() == "-a" {
+		t.pos++
+		var ok2 bool
+		ok2, err = t.not()
+		ok = ok && ok2
+	}
+	return ok, err
+}
+
+func (t *tester) not() (bool, error) {
+	if t.peek() == "!" && t.pos+1 < len(t.args) {
+		t.pos++
+		ok, err := t.not()
+		return !ok, err
+	}
+	return t.primary()
+}
+
+func (t *tester) primary() (bool, error) {
+	a, err := t.next()
+	if err != nil {
+		return false, err
+	}
+	if a == "(" {
+		ok, err := t.or()
+		if err != nil {
+			return false, err
+		}
+		if t.peek() != ")" {
+			return false, errors.New("`)' expected")
+		}
+		t.pos++
+		return ok, nil
+	}
+	if isUnaryTest(a) && t.pos < len(t.args) {
+		b, _ := t.next()
+		return t.unary(a, b)
+	}
+	if op := t.peek(); isBinaryTest(op) && t.pos+1 < len(t.args) {
+		t.pos++
+		b, _ := t.next()
+		return t.binary(a, op, b)
+	}
+	return a != "", nil
+}
+
+func isUnaryTest(op string) bool {
+	switch op {
+	case "-b", "-c", "-d", "-e", "-f", "-g", "-h", "-k", "-L", "-n", "-p", "-r", "-s", "-S", "-t", "-u", "-w", "-x", "-z":
+		return true
+	}
+	return false
+}
+
+func isBinaryTest(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<", ">", "-eq", "-ne", "-lt", "-le", "-gt", "-ge", "-nt", "-ot", "-ef":
+		return true
+	}
+	return false
+}
+
+func (t *tester) path(name string) string {
+	if t.p != nil && t.p.Dir != "" && !filepath.IsAbs(name) {
+		return filepath.Join(t.p.Dir, name)
+	}
+	return name
+}
+
+func (t *tester) unary(op, a string) (bool, error) {
+	switch op {
+	case "-n":
+		return a != "", nil
+	case "-z":
+		return a == "", nil
+	case "-t":
+		// There is no terminal to ask about.
+		return false, nil
+	}
+
+	stat := os.Stat
+	if op == "-h" || op == "-L" {
+		stat = os.Lstat
+	}
+	fi, err := stat(t.path(a))
+	if err != nil {
+		return false, nil
+	}
+	mode := fi.Mode()
+	switch op {
+	case "-b":
+		return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0, nil
+	case "-c":
+		return mode&os.ModeCharDevice != 0, nil
+	case "-d":
+		return mode.IsDir(), nil
+	case "-f":
+		return mode.IsRegular(), nil
+	case "-g":
+		return mode&os.ModeSetgid != 0, nil
+	case "-h", "-L":
+		return mode&os.ModeSymlink != 0, nil
+	case "-k":
+		return mode&os.ModeSticky != 0, nil
+	case "-p":
+		return mode&os.ModeNamedPipe != 0, nil
+	case "-r":
+		return access(t.path(a), fi, 0444), nil
+	case "-s":
+		return fi.Size() > 0, nil
+	case "-S":
+		return mode&os.ModeSocket != 0, nil
+	case "-u":
+		return mode&os.ModeSetuid != 0, nil
+	case "-w":
+		return access(t.path(a), fi, 0222), nil
+	case "-x":
+		return access(t.path(a), fi, 0111), nil
+	}
+	return true, nil
+}
+
+func (t *tester) binary(a, op, b string) (bool, error) {
+	switch op {
+	case "=", "==":
+		return a == b, nil
+	case "!=":
+		return a != b, nil
+	case "<":
+		return a < b, nil
+	case ">":
+		return a > b, nil
+	case "-nt", "-ot", "-ef":
+		fa, erra := os.Stat(t.path(a))
+		fb, errb := os.Stat(t.path(b))
+		switch op {
+		case "-nt":
+			return erra == nil && (errb != nil || fa.ModTime().After(fb.ModTime())), nil
+		case "-ot":
+			return errb == nil && (erra != nil || fa.ModTime().Before(fb.ModTime())), nil
+		}
+		return erra == nil && errb == nil && os.SameFile(fa, fb), nil
+	}
+
+	x, err := strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", a)
+	}
+	y, err := strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", b)
+	}
+	switch op {
+	case "-eq":
+		return x == y, nil
+	case "-ne":
+		return x != y, nil
+	case "-lt":
+		return x < y, nil
+	case "-le":
+		return x <= y, nil
+	case "-gt":
+		return x > y, nil
+	}
+	return x >= y, nil
+}
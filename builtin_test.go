@@ -0,0 +1,210 @@
+package shellwords
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs POSIX commands")
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "file"), []byte("x"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		script string
+		status int
+		out    string
+	}{
+		{`true`, 0, ""},
+		{`false`, 1, ""},
+		{`echo a   b`, 0, "a b\n"},
+		{`echo -n a; echo b`, 0, "ab\n"},
+		{`echo -e 'a\tb\0101\c' c; echo`, 0, "a\tbA\n"},
+		{`echo -E 'a\tb' -n`, 0, "a\\tb -n\n"},
+		{`printf '%s=%d\n' a 1 b 2`, 0, "a=1\nb=2\n"},
+		{`printf '%5s|%-3d|%03x|%.2f|%c\n' ab 7 255 3.14159 xyz`, 0, "   ab|7  |0ff|3.14|x\n"},
+		{`printf '%b %q\101\n' 'a\nb' "it's"`, 0, "a\nb 'it'\\''s'A\n"},
+		{`printf '%d\n' "'A" 0x10`, 0, "65\n16\n"},
+		{`printf '%d\n' x`, 1, "0\n"},
+		{`test a = a && [ 1 -lt 2 ] && [ -n x ] && [ ! -z x ]`, 0, ""},
+		{`[ a = b ] || test -z ''`, 0, ""},
+		{`test 1 -gt 2 -o \( a != b -a -d sub \)`, 0, ""},
+		{`test -f sub/file && test ! -f sub && test -s sub/file && test -e nope`, 1, ""},
+		{`test -n`, 0, ""},
+		{`test 1 -eq x`, 2, ""},
+		{`test -r sub/file && test -w sub/file && test ! -x sub/file && test -x sub`, 0, ""},
+		{`[ a = a`, 2, ""},
+		{`cd sub && cat file && cd .. && test -d sub`, 0, "x"},
+		{`cd nope`, 1, ""},
+		{`export FOO=bar; sh -c 'echo $FOO'; echo $FOO`, 0, "bar\nbar\n"},
+		{`export FOO=bar; unset FOO; sh -c 'echo "[$FOO]"'`, 0, "[]\n"},
+		{`export 1x=y`, 1, ""},
+		{`echo a; exit 3; echo b`, 3, "a\n"},
+		{`false; exit`, 1, ""},
+		{`exit 1 | echo a; echo b`, 0, "a\nb\n"},
+		{`cd sub | true; test -d sub`, 0, ""},
+		{`echo abc | tr a-z A-Z`, 0, "ABC\n"},
+		{`printf 'b\na\n' | sort`, 0, "a\nb\n"},
+		{`echo hi >out.txt; cat out.txt`, 0, "hi\n"},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		parser := NewParser()
+		parser.ParseEnv = true
+		parser.Escape = EscapePOSIX
+		parser.Dir = dir
+		parser.Env = []string{"PATH=" + os.Getenv("PATH")}
+		r := &Runner{Parser: parser, Stdin: strings.NewReader(""), Stdout: &stdout, Stderr: &stderr}
+		status, err := r.RunScript(context.Background(), test.script)
+		if err != nil {
+			t.Fatalf("%q: %v", test.script, err)
+		}
+		if status != test.status || stdout.String() != test.out {
+			t.Fatalf("%q: Expected %d %q, but %d %q (%s)", test.script, test.status, test.out, status, stdout.String(), stderr.String())
+		}
+	}
+}
+
+func TestBuiltinTestAccess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	dir := t.TempDir()
+	for name, perm := range map[string]os.FileMode{"ro": 0444, "wo": 0200, "x": 0755, "none": 0} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The builtin gives what test of sh does, as the user this runs as.
+	var stdout, stderr bytes.Buffer
+	parser := NewParser()
+	parser.Dir = dir
+	r := &Runner{Parser: parser, Stdout: &stdout, Stderr: &stderr}
+	var want strings.Builder
+	for _, f := range []string{"ro", "wo", "x", "none"} {
+		for _, op := range []string{"-r", "-w", "-x"} {
+			cmd := exec.Command("sh", "-c", `test "$0" "$1"`, op, f)
+			cmd.Dir = dir
+			status := 0
+			if err := cmd.Run(); err != nil {
+				status = 1
+			}
+			fmt.Fprintf(&want, "%s %s %d\n", f, op, status)
+			if _, err := r.RunScript(context.Background(), "test "+op+" "+f+" && echo "+f+" "+op+" 0 || echo "+f+" "+op+" 1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if stdout.String() != want.String() {
+		t.Fatalf("Expected %q, but %q (%s)", want.String(), stdout.String(), stderr.String())
+	}
+}
+
+func TestBuiltinCd(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	parser := NewParser()
+	parser.Dir = dir
+	parser.Env = []string{}
+	r := &Runner{Parser: parser, Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+	if _, err := r.RunScript(context.Background(), `cd sub`); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "sub"); parser.Dir != want {
+		t.Fatalf("Expected %q, but %q", want, parser.Dir)
+	}
+	if pwd, _ := lookupEnv(parser.Env, "PWD"); pwd != parser.Dir {
+		t.Fatalf("Expected PWD %q, but %q", parser.Dir, pwd)
+	}
+	if old, _ := lookupEnv(parser.Env, "OLDPWD"); old != dir {
+		t.Fatalf("Expected OLDPWD %q, but %q", dir, old)
+	}
+}
+
+func TestBuiltinCdNilEnv(t *testing.T) {
+	parser := NewParser()
+	parser.Dir = t.TempDir()
+	r := &Runner{Parser: parser, Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+	if status, err := r.RunScript(context.Background(), `cd ..`); status != 0 || err != nil {
+		t.Fatalf("Expected 0, but %d %v", status, err)
+	}
+	if parser.Env != nil {
+		t.Fatalf("Expected nil Env, but %d variables", len(parser.Env))
+	}
+}
+
+func TestBuiltinGetenv(t *testing.T) {
+	vars := map[string]string{"FOO": "old"}
+	parser := NewParser()
+	parser.ParseEnv = true
+	parser.Env = []string{}
+	parser.Getenv = func(name string) string { return vars[name] }
+	parser.Setenv = func(name, value string) error {
+		vars[name] = value
+		return nil
+	}
+	var stdout bytes.Buffer
+	r := &Runner{Parser: parser, Stdout: &stdout, Stderr: &bytes.Buffer{}}
+	status, err := r.RunScript(context.Background(), `export FOO=new; echo $FOO; unset FOO; echo "[$FOO]"; export BAR=x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "new\n[]\n"; status != 0 || stdout.String() != want {
+		t.Fatalf("Expected 0 %q, but %d %q", want, status, stdout.String())
+	}
+	if bar, _ := lookupEnv(parser.Env, "BAR"); bar != "x" || vars["BAR"] != "x" {
+		t.Fatalf("Expected BAR in Env and vars, but %q %q", bar, vars["BAR"])
+	}
+
+	// A pipeline or the background sets its own variables.
+	if _, err := r.RunScript(context.Background(), `export FOO=pipe | true; export FOO=bg &`); err != nil {
+		t.Fatal(err)
+	}
+	if vars["FOO"] != "" {
+		t.Fatalf("Expected FOO to be unset, but %q", vars["FOO"])
+	}
+
+	parser.Setenv = nil
+	if status, _ := r.RunScript(context.Background(), `export FOO=a`); status != 1 {
+		t.Fatalf("Expected 1, but %d", status)
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	var stdout bytes.Buffer
+	r := &Runner{Stdin: strings.NewReader(""), Stdout: &stdout, Stderr: &bytes.Buffer{}}
+	r.Register("greet", func(ctx context.Context, bc *BuiltinContext) int {
+		name := "world"
+		if len(bc.Args) > 1 {
+			name = bc.Args[1]
+		}
+		fmt.Fprintf(bc.Stdout, "hello, %s\n", name)
+		return len(bc.Args) - 1
+	})
+	status, err := r.RunScript(context.Background(), `greet; greet gopher && echo no || echo yes`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello, world\nhello, gopher\nyes\n"; status != 0 || stdout.String() != want {
+		t.Fatalf("Expected 0 %q, but %d %q", want, status, stdout.String())
+	}
+	if _, ok := DefaultBuiltins["greet"]; ok {
+		t.Fatal("Register should not change DefaultBuiltins")
+	}
+}
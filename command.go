@@ -0,0 +1,323 @@
+package shellwords
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var errNoCommand = errors.New("no command")
+
+// Command returns the command to run line, a simple command such as
+// FOO=1 cmd arg >out 2>&1. Its environment is Env with the assignments
+// before the command added, it runs in Dir, and its redirections are opened.
+// The command is looked up in the PATH of that environment, as the shell
+// does, with its relative directories in Dir, and it is an error if it is
+// not found there. Here-documents are given as they are written, without
+// expansions.
+//
+// Without redirections the command reads and writes the standard input,
+// output and error of this process. The files opened for redirections are
+// left in Stdin, Stdout, Stderr and ExtraFiles of the command; close them
+// once it has started.
+func (p *Parser) Command(ctx context.Context, line string) (*exec.Cmd, error) {
+	list, err := p.ParseScript(line)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := simpleCommand(list)
+	if err != nil {
+		return nil, err
+	}
+	fds := map[int]interface{}{0: os.Stdin, 1: os.Stdout, 2: os.Stderr}
+	assigns, args, files, err := p.expandCommand(sc, fds)
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := p.command(ctx, assigns, args, fds)
+	if err != nil {
+		for _, f := range files {
+			f.Close()
+		}
+		p.closeProcSubst()
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// expandCommand expands the words of sc and applies its redirections to
+// fds. It returns the files it opened too.
+func (p *Parser) expandCommand(sc *SimpleCommand, fds map[int]interface{}) ([]Assignment, []string, []*os.File, error) {
+	// The words were read by ParseScript already; expand them as they are.
+	q := *p
+	q.Aliases = nil
+	q.ParseHistory = false
+	q.RejectUnsupported = false
+	var raws []string
+	for _, w := range sc.Assigns {
+		raws = append(raws, w.Raw)
+	}
+	for _, w := range sc.Args {
+		raws = append(raws, w.Raw)
+	}
+	q.ParseLineContinuation = true
+	assigns, args, err := q.ParseWithAssignments(strings.Join(raws, " "))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(args) == 0 {
+		q.closeProcSubst()
+		return nil, nil, nil, errNoCommand
+	}
+	files, err := q.redirect(sc.Redirs, fds)
+	if err != nil {
+		q.closeProcSubst()
+		return nil, nil, nil, err
+	}
+	return assigns, args, files, nil
+}
+
+// command returns the command to run args with the file descriptors fds.
+func (p *Parser) command(ctx context.Context, assigns []Assignment, args []string, fds map[int]interface{}) (*exec.Cmd, error) {
+	env := mergeEnv(p.Env, assigns)
+	name := args[0]
+	if path, ok := lookupEnv(env, "PATH"); ok {
+		var err error
+		if name, err = p.lookPath(name, path); err != nil {
+			return nil, err
+		}
+	}
+	cmd := exec.CommandContext(ctx, name, args[1:]...)
+	cmd.Args[0] = args[0]
+	cmd.Dir = p.Dir
+	cmd.Env = env
+	for n, f := range fds {
+		switch n {
+		case 0:
+			if r, ok := f.(io.Reader); ok {
+				cmd.Stdin = r
+			} else {
+				cmd.Stdin = nil
+			}
+		case 1, 2:
+			w, ok := f.(io.Writer)
+			if !ok {
+				w = nil
+			}
+			if n == 1 {
+				cmd.Stdout = w
+			} else {
+				cmd.Stderr = w
+			}
+		default:
+			file, ok := f.(*os.File)
+			if !ok && f != nil {
+				return nil, fmt.Errorf("%d: here-document on a file descriptor above 2", n)
+			}
+			for len(cmd.ExtraFiles) <= n-3 {
+				cmd.ExtraFiles = append(cmd.ExtraFiles, nil)
+			}
+			cmd.ExtraFiles[n-3] = file
+		}
+	}
+	return cmd, nil
+}
+
+// lookPath returns the absolute path of the command name in the
+// directories of path, which are relative to Dir. A name with a slash is
+// returned as it is.
+func (p *Parser) lookPath(name, path string) (string, error) {
+	if strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		if p.Dir != "" && !filepath.IsAbs(dir) {
+			dir = filepath.Join(p.Dir, dir)
+		}
+		if found, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return filepath.Abs(found)
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// Command returns the command to run line with the default parser.
+func Command(ctx context.Context, line string) (*exec.Cmd, error) {
+	return NewParser().Command(ctx, line)
+}
+
+// simpleCommand returns the command of list if it is a simple command.
+func simpleCommand(list *List) (*SimpleCommand, error) {
+	if len(list.Items) == 0 {
+		return nil, errNoCommand
+	}
+	if len(list.Items) > 1 || list.Items[0].Background {
+		return nil, &UnsupportedError{Construct: "list", Span: list.Span}
+	}
+	ao := list.Items[0]
+	if len(ao.Pipelines) > 1 {
+		return nil, &UnsupportedError{Construct: "and-or list", Span: ao.Span}
+	}
+	pl := ao.Pipelines[0]
+	if len(pl.Cmds) > 1 || pl.Bang {
+		return nil, &UnsupportedError{Construct: "pipeline", Span: pl.Span}
+	}
+	sc, ok := pl.Cmds[0].(*SimpleCommand)
+	if !ok {
+		return nil, &UnsupportedError{Construct: construct(pl.Cmds[0]), Span: pl.Cmds[0].Pos()}
+	}
+	return sc, nil
+}
+
+// mergeEnv returns base, or os.Environ() if base is nil, with assigns set.
+// A variable set more than once keeps the last value.
+func mergeEnv(base []string, assigns []Assignment) []string {
+	if base == nil {
+		base = os.Environ()
+	}
+	var env []string
+	index := map[string]int{}
+	set := func(kv string) {
+		key := envKey(envName(kv))
+		if i, ok := index[key]; ok {
+			env[i] = kv
+			return
+		}
+		index[key] = len(env)
+		env = append(env, kv)
+	}
+	for _, kv := range base {
+		set(kv)
+	}
+	for _, a := range assigns {
+		set(a.String())
+	}
+	return env
+}
+
+// envName returns the name of the variable kv, which is NAME=value.
+func envName(kv string) string {
+	// Skip the first byte for the =C:=C:\dir variables of Windows.
+	if i := strings.IndexByte(kv, '='); i > 0 {
+		return kv[:i]
+	} else if i == 0 {
+		if i = strings.IndexByte(kv[1:], '='); i >= 0 {
+			return kv[:i+1]
+		}
+	}
+	return kv
+}
+
+// lookupEnv returns the value of the variable name in env.
+func lookupEnv(env []string, name string) (string, bool) {
+	key := envKey(name)
+	for i := len(env) - 1; i >= 0; i-- {
+		if n := envName(env[i]); envKey(n) == key && len(n) < len(env[i]) {
+			return env[i][len(n)+1:], true
+		}
+	}
+	return "", false
+}
+
+// redirect applies redirs to fds. It returns the files it opened.
+func (p *Parser) redirect(redirs []*Redirect, fds map[int]interface{}) (_ []*os.File, err error) {
+	var opened []*os.File
+	defer func() {
+		if err != nil {
+			for _, f := range opened {
+				f.Close()
+			}
+		}
+	}()
+
+	open := func(r *Redirect, flag int) (*os.File, error) {
+		values, err := p.ExpandWord(r.Target)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%s: ambiguous redirect", r.Target.Raw)
+		}
+		name := values[0]
+		if p.Dir != "" && !filepath.IsAbs(name) {
+			name = filepath.Join(p.Dir, name)
+		}
+		f, err := os.OpenFile(name, flag, 0666)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, f)
+		return f, nil
+	}
+
+	for _, r := range redirs {
+		n := r.N
+		if n < 0 {
+			n = 1
+			if strings.HasPrefix(r.Op, "<") {
+				n = 0
+			}
+		}
+		switch r.Op {
+		case "<":
+			fds[n], err = open(r, os.O_RDONLY)
+		case ">", ">|":
+			fds[n], err = open(r, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		case ">>":
+			fds[n], err = open(r, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+		case "<>":
+			fds[n], err = open(r, os.O_RDWR|os.O_CREATE)
+		case "&>", "&>>":
+			flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if r.Op == "&>>" {
+				flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+			var f *os.File
+			if f, err = open(r, flag); err == nil {
+				fds[1], fds[2] = f, f
+			}
+		case "<<", "<<-":
+			fds[n] = strings.NewReader(r.Heredoc)
+		case "<<<":
+			var values []string
+			if values, err = p.ExpandWord(r.Target); err == nil {
+				fds[n] = strings.NewReader(strings.Join(values, " ") + "\n")
+			}
+		case "<&", ">&":
+			switch {
+			case r.Target.Raw == "-":
+				fds[n] = nil
+			case isDigits(r.Target.Raw):
+				m, _ := strconv.Atoi(r.Target.Raw)
+				f, ok := fds[m]
+				if !ok {
+					return nil, fmt.Errorf("%d: bad file descriptor", m)
+				}
+				fds[n] = f
+			case r.Op == ">&" && r.N < 0:
+				var f *os.File
+				if f, err = open(r, os.O_WRONLY|os.O_CREATE|os.O_TRUNC); err == nil {
+					fds[1], fds[2] = f, f
+				}
+			default:
+				return nil, fmt.Errorf("%s: ambiguous redirect", r.Target.Raw)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unsupported redirection", r.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return opened, nil
+}
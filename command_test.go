@@ -0,0 +1,145 @@
+package shellwords
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("input"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewParser()
+	parser.ParseEnv = true
+	parser.Dir = dir
+	path := "PATH=" + os.Getenv("PATH")
+	parser.Env = []string{path, "FOO=old", "KEEP=1"}
+	parser.Getenv = func(name string) string { return "" }
+	cmd, err := parser.Command(context.Background(), `FOO=a BAR=$FOO/b ./prog "x y" $BAR <in.txt >out.txt 2>&1 3>>log.txt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []*os.File{cmd.Stdin.(*os.File), cmd.Stdout.(*os.File), cmd.ExtraFiles[0]}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	if want := []string{"./prog", "x y"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Fatalf("Expected %#v, but %#v", want, cmd.Args)
+	}
+	if want := []string{path, "FOO=a", "KEEP=1", "BAR=a/b"}; !reflect.DeepEqual(cmd.Env, want) {
+		t.Fatalf("Expected %#v, but %#v", want, cmd.Env)
+	}
+	if cmd.Dir != dir {
+		t.Fatalf("Expected %q, but %q", dir, cmd.Dir)
+	}
+	if b, err := io.ReadAll(cmd.Stdin); err != nil || string(b) != "input" {
+		t.Fatalf("Expected %q, but %q %v", "input", b, err)
+	}
+	if cmd.Stderr != cmd.Stdout {
+		t.Fatal("Expected stderr to be stdout")
+	}
+	if name := cmd.Stdout.(*os.File).Name(); name != filepath.Join(dir, "out.txt") {
+		t.Fatalf("Expected %q, but %q", filepath.Join(dir, "out.txt"), name)
+	}
+	if len(cmd.ExtraFiles) != 1 || cmd.ExtraFiles[0].Name() != filepath.Join(dir, "log.txt") {
+		t.Fatalf("Expected log.txt as fd 3, but %v", cmd.ExtraFiles)
+	}
+}
+
+func TestCommandHeredoc(t *testing.T) {
+	cmd, err := Command(context.Background(), "cat <<EOF 2>&-\nhello\nEOF\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(cmd.Stdin); err != nil || string(b) != "hello\n" {
+		t.Fatalf("Expected %q, but %q %v", "hello\n", b, err)
+	}
+	if cmd.Stdout != os.Stdout || cmd.Stderr != nil {
+		t.Fatalf("Expected stdout and no stderr, but %v %v", cmd.Stdout, cmd.Stderr)
+	}
+
+	cmd, err = Command(context.Background(), `cat <<< "a b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(cmd.Stdin); err != nil || string(b) != "a b\n" {
+		t.Fatalf("Expected %q, but %q %v", "a b\n", b, err)
+	}
+}
+
+func TestCommandPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs an executable script")
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "bin"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	hello := filepath.Join(dir, "bin", "hello")
+	if err := os.WriteFile(hello, []byte("#!/bin/sh\necho hello\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewParser()
+	parser.Dir = dir
+	for _, line := range []string{`PATH=/nonexistent:` + filepath.Dir(hello) + ` hello`, `PATH=bin hello`} {
+		cmd, err := parser.Command(context.Background(), line)
+		if err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		if cmd.Path != hello || cmd.Args[0] != "hello" {
+			t.Fatalf("%q: Expected %q, but %q %q", line, hello, cmd.Path, cmd.Args[0])
+		}
+		cmd.Stdout = nil
+		if out, err := cmd.Output(); err != nil || string(out) != "hello\n" {
+			t.Fatalf("%q: Expected %q, but %q %v", line, "hello\n", out, err)
+		}
+	}
+	if _, err := parser.Command(context.Background(), `PATH=/nonexistent ls`); err == nil {
+		t.Fatal("Should be an error")
+	}
+
+	// A relative directory is in Dir even if PATH is the one of this process.
+	old := os.Getenv("PATH")
+	defer os.Setenv("PATH", old)
+	os.Setenv("PATH", "bin")
+	parser.Env = []string{"PATH=bin"}
+	cmd, err := parser.Command(context.Background(), `hello`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Path != hello {
+		t.Fatalf("Expected %q, but %q", hello, cmd.Path)
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	for _, line := range []string{``, `FOO=1`, `a | b`, `a; b`, `a && b`, `(a)`, `a <nonexistent/file`, `a 2>&x`, `a 1>&9`} {
+		_, err := Command(context.Background(), line)
+		if err == nil {
+			t.Fatalf("%q: Should be an error", line)
+		}
+	}
+	_, err := Command(context.Background(), `if a; then b; fi`)
+	if e, ok := err.(*UnsupportedError); !ok || !strings.Contains(e.Construct, "if") {
+		t.Fatalf("Expected *UnsupportedError, but %v", err)
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	env := mergeEnv([]string{"A=1", "B=2", "=C:=C:\\", "A=3"}, []Assignment{{"B", "x"}, {"D", "y"}})
+	if want := []string{"A=3", "B=x", "=C:=C:\\", "D=y"}; !reflect.DeepEqual(env, want) {
+		t.Fatalf("Expected %#v, but %#v", want, env)
+	}
+}
@@ -0,0 +1,120 @@
+package shellwords
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Span is a range of bytes [Start, End) in the line given to the parser.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Severity tells how serious a Diagnostic is.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Diagnostic is a problem found in the line while parsing.
+type Diagnostic struct {
+	Span     Span
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d-%d: %s: %s", d.Span.Start, d.Span.End, d.Severity, d.Message)
+}
+
+// fail records err as a diagnostic. In tolerant mode it returns nil so the
+// caller can carry on, otherwise it returns err.
+func (p *Parser) fail(span Span, err error) error {
+	p.Diagnostics = append(p.Diagnostics, Diagnostic{Span: span, Severity: SeverityError, Message: err.Error()})
+	if p.Tolerant {
+		return nil
+	}
+	return err
+}
+
+// report records a diagnostic. In tolerant mode it returns nil so the caller
+// can carry on, otherwise it returns the error Parse has always returned.
+func (p *Parser) report(span Span, severity Severity, msg string) error {
+	p.Diagnostics = append(p.Diagnostics, Diagnostic{Span: span, Severity: severity, Message: msg})
+	if p.Tolerant {
+		return nil
+	}
+	return errInvalidLine
+}
+
+// region is where the text written at Span was put once the line was
+// expanded by a stage which runs before parsing, like alias expansion.
+type region struct {
+	Start int
+	End   int
+	Span  Span
+}
+
+// mapOffset maps off in the expanded line back to the line which was
+// written. Offsets inside a region map to the start or, if end is true,
+// to the end of what was written there.
+func mapOffset(regions []region, off int, end bool) int {
+	delta := 0
+	for _, r := range regions {
+		if off <= r.Start {
+			break
+		}
+		if off < r.End {
+			if end {
+				return r.Span.End
+			}
+			return r.Span.Start
+		}
+		delta += (r.End - r.Start) - (r.Span.End - r.Span.Start)
+	}
+	return off - delta
+}
+
+// parseExpanded parses expanded, the result of expanding line, with parse
+// and maps the spans and the position back to line.
+func (p *Parser) parseExpanded(line, expanded string, regions []region, parse func(string) ([]Token, error)) ([]Token, error) {
+	mapSpan := func(span Span) Span {
+		return Span{Start: mapOffset(regions, span.Start, false), End: mapOffset(regions, span.End, true)}
+	}
+
+	tokens, err := parse(expanded)
+	for i := range tokens {
+		tokens[i].Span = mapSpan(tokens[i].Span)
+	}
+	for i := range p.Diagnostics {
+		p.Diagnostics[i].Span = mapSpan(p.Diagnostics[i].Span)
+	}
+	if e, ok := err.(*UnsupportedError); ok {
+		e.Span = mapSpan(e.Span)
+	}
+	if p.Position >= 0 {
+		off := len(expanded)
+		if n := p.Position; n < utf8.RuneCountInString(expanded) {
+			off = 0
+			for ; n > 0; n-- {
+				_, size := utf8.DecodeRuneInString(expanded[off:])
+				off += size
+			}
+		}
+		p.Position = utf8.RuneCountInString(line[:mapOffset(regions, off, false)])
+	}
+	return tokens, err
+}
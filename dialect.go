@@ -0,0 +1,82 @@
+package shellwords
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect is the system whose rules apply to paths and commands.
+type Dialect int
+
+const (
+	// DialectHost is the dialect of the system this program runs on,
+	// HostDialect.
+	DialectHost Dialect = iota
+
+	// DialectPOSIX is for Unix-like systems: paths separated by / and
+	// PATH by ':', and executables marked by their permissions.
+	DialectPOSIX
+
+	// DialectWindows is for Windows: paths separated by \ or / and PATH
+	// by ';', and executables found by the extensions in PATHEXT.
+	DialectWindows
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectHost:
+		return "Host"
+	case DialectPOSIX:
+		return "POSIX"
+	case DialectWindows:
+		return "Windows"
+	}
+	return "Dialect(" + strconv.Itoa(int(d)) + ")"
+}
+
+// listSep returns the separator of the lists of directories in PATH.
+func (d Dialect) listSep() string {
+	if d == DialectWindows {
+		return ";"
+	}
+	return ":"
+}
+
+func (d Dialect) isSep(c byte) bool {
+	return c == '/' || d == DialectWindows && c == '\\'
+}
+
+// hasSep reports whether name has a directory in it, and so is not looked
+// up in PATH.
+func (d Dialect) hasSep(name string) bool {
+	if d == DialectWindows {
+		return strings.ContainsAny(name, `/\:`)
+	}
+	return strings.Contains(name, "/")
+}
+
+// isAbs reports whether path does not depend on the current directory.
+// On Windows \dir and C:dir are taken as absolute, as they do not
+// depend on it alone.
+func (d Dialect) isAbs(path string) bool {
+	if d == DialectWindows {
+		if len(path) >= 2 && path[1] == ':' {
+			return true
+		}
+	}
+	return path != "" && d.isSep(path[0])
+}
+
+// join returns name in the directory dir, or name if it is absolute.
+func (d Dialect) join(dir, name string) string {
+	if dir == "" || d.isAbs(name) {
+		return name
+	}
+	if d.isSep(dir[len(dir)-1]) {
+		return dir + name
+	}
+	if d == DialectWindows {
+		return dir + `\` + name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,88 @@
+package shellwords
+
+import (
+	"errors"
+	"os"
+)
+
+var errBadSubstitution = errors.New("bad substitution")
+
+func (p *Parser) getenv(name string) string {
+	if value, ok := p.assigned[name]; ok {
+		return value
+	}
+	if p.Getenv != nil {
+		return p.Getenv(name)
+	}
+	if p.Env != nil {
+		value, _ := lookupEnv(p.Env, name)
+		return value
+	}
+	return os.Getenv(name)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
+
+// isName reports whether s is a valid POSIX name.
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandParam expands $NAME or ${NAME} starting at the '$' in line[off].
+// ok is false if the '$' does not start a parameter and stays literal.
+func (p *Parser) expandParam(line string, off int) (value string, end int, ok bool, err error) {
+	i := off + 1
+	if i == len(line) {
+		return "", 0, false, nil
+	}
+	switch c := line[i]; {
+	case c == '{':
+		j := i + 1
+		for j < len(line) && line[j] != '}' {
+			j++
+		}
+		if j == len(line) {
+			return "", 0, false, errBadSubstitution
+		}
+		name := line[i+1 : j]
+		if !isName(name) && !isDigits(name) {
+			return "", 0, false, errBadSubstitution
+		}
+		return p.getenv(name), j + 1, true, nil
+	case '0' <= c && c <= '9':
+		return p.getenv(line[i : i+1]), i + 1, true, nil
+	case isNameStart(c):
+		j := i + 1
+		for j < len(line) && isNameChar(line[j]) {
+			j++
+		}
+		return p.getenv(line[i:j]), j, true, nil
+	}
+	return "", 0, false, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || '9' < s[i] {
+			return false
+		}
+	}
+	return true
+}
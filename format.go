@@ -0,0 +1,232 @@
+package shellwords
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format returns the command line format with each of its verbs replaced
+// by the matching one of args as a word quoted for a POSIX shell, so that
+// the values are never read as anything but a word each. A []string given
+// to %v becomes a word for each element, or nothing if it is empty. %% is
+// a percent sign.
+//
+// A verb must be a whole word, between blanks or operators; Format fails
+// for one inside quotes, a comment, arithmetic, a here-document or a
+// longer word, as in '%s', $((%s)) or --name=%s, since its value would not
+// be a word of its own. Missing or extra args are an error too.
+//
+//	line, err := shellwords.Format("git commit -m %s -- %v", msg, paths)
+func Format(format string, args ...interface{}) (string, error) {
+	var b strings.Builder
+	n := 0
+	// The quote, or other construct, the format is in at i: one of ' " `
+	// $', # for a comment and (( for arithmetic, in which depth
+	// parentheses are open.
+	var in string
+	depth := 0
+	// The here-documents whose bodies start on the next line.
+	var heredocs []heredoc
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		escaped := false
+		switch {
+		case c == '%':
+			if i+1 < len(format) && format[i+1] == '%' {
+				b.WriteByte('%')
+				i++
+				continue
+			}
+			if i+1 == len(format) {
+				return "", fmt.Errorf("%% at %d: no verb", i)
+			}
+			verb := format[i+1]
+			where := ""
+			switch {
+			case in == "#":
+				where = "is in a comment"
+			case in == "((":
+				where = "is in arithmetic"
+			case in != "":
+				where = "is inside " + in + " quotes"
+			case i > 0 && !isWordEnd(format[i-1]):
+				where = "follows " + string(format[i-1])
+			case i+2 < len(format) && !isWordEnd(format[i+2]):
+				where = "is followed by " + string(format[i+2])
+			}
+			if where != "" {
+				return "", fmt.Errorf("%%%c at %d %s; it must be a whole word", verb, i, where)
+			}
+			if n == len(args) {
+				return "", fmt.Errorf("%%%c at %d: missing argument", verb, i)
+			}
+			s, err := formatArg(verb, args[n])
+			if err != nil {
+				return "", fmt.Errorf("%%%c at %d: %w", verb, i, err)
+			}
+			b.WriteString(s)
+			n++
+			i++
+			continue
+		case in == "#":
+			if c == '\n' {
+				in = ""
+			}
+		case in == "'" || in == "$'":
+			if c == '\'' {
+				in = ""
+			} else if c == '\\' && in == "$'" && i+1 < len(format) {
+				b.WriteByte(c)
+				i++
+				c = format[i]
+			}
+		case in == "((":
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				if depth--; depth == 0 {
+					in = ""
+				}
+			}
+		case c == '\\' && in != "'" && i+1 < len(format):
+			b.WriteByte(c)
+			i++
+			c = format[i]
+			escaped = true
+		case in == "\"" && c == '"', in == "`" && c == '`':
+			in = ""
+		case in != "":
+		case c == '\'' || c == '"' || c == '`':
+			in = string(c)
+		case c == '$' && i+1 < len(format) && format[i+1] == '\'':
+			in = "$'"
+			b.WriteByte(c)
+			i++
+			c = format[i]
+		case c == '#' && (i == 0 || isWordEnd(format[i-1])):
+			in = "#"
+		case strings.HasPrefix(format[i:], "((") || strings.HasPrefix(format[i:], "$(("):
+			in = "(("
+			depth = 2
+			n := strings.Index(format[i:], "((") + 2
+			b.WriteString(format[i : i+n])
+			i += n - 1
+			continue
+		case strings.HasPrefix(format[i:], "<<<"):
+			b.WriteString("<<<")
+			i += 2
+			continue
+		case strings.HasPrefix(format[i:], "<<"):
+			h, end, err := formatHeredoc(format, i)
+			if err != nil {
+				return "", err
+			}
+			heredocs = append(heredocs, h)
+			b.WriteString(format[i:end])
+			i = end - 1
+			continue
+		}
+		b.WriteByte(c)
+		if c == '\n' && in == "" && !escaped && len(heredocs) > 0 {
+			end, err := formatHeredocBodies(&b, format, i+1, heredocs)
+			if err != nil {
+				return "", err
+			}
+			heredocs = nil
+			i = end - 1
+		}
+	}
+	if n < len(args) {
+		return "", fmt.Errorf("%d arguments left over", len(args)-n)
+	}
+	return b.String(), nil
+}
+
+// heredoc is a here-document whose body is still to come.
+type heredoc struct {
+	delim string
+	dash  bool
+}
+
+// formatHeredoc reads the << or <<- operator at format[i] and its
+// delimiter, and returns where they end. The delimiter can't be a verb.
+func formatHeredoc(format string, i int) (heredoc, int, error) {
+	var h heredoc
+	j := i + 2
+	if j < len(format) && format[j] == '-' {
+		h.dash = true
+		j++
+	}
+	for j < len(format) && (format[j] == ' ' || format[j] == '\t') {
+		j++
+	}
+	end := j
+	for end < len(format) && !isWordEnd(format[end]) {
+		end++
+	}
+	word := format[j:end]
+	if strings.IndexByte(word, '%') >= 0 {
+		return h, 0, fmt.Errorf("%% at %d is in a here-document delimiter", j+strings.IndexByte(word, '%'))
+	}
+	h.delim = strings.NewReplacer(`'`, "", `"`, "", `\`, "").Replace(word)
+	return h, end, nil
+}
+
+// formatHeredocBodies copies the bodies of heredocs, which start at
+// format[i], to b, and returns where they end. A verb can't be in a body,
+// which may or may not be expanded; %% is a percent sign there too.
+func formatHeredocBodies(b *strings.Builder, format string, i int, heredocs []heredoc) (int, error) {
+	for _, h := range heredocs {
+		for i < len(format) {
+			end := strings.IndexByte(format[i:], '\n') + 1
+			if end == 0 {
+				end = len(format)
+			} else {
+				end += i
+			}
+			var line strings.Builder
+			for j := i; j < end; j++ {
+				if format[j] == '%' {
+					if j+1 == end || format[j+1] != '%' {
+						return 0, fmt.Errorf("%% at %d is in a here-document; it must be a whole word", j)
+					}
+					j++
+				}
+				line.WriteByte(format[j])
+			}
+			b.WriteString(line.String())
+			i = end
+			l := strings.TrimSuffix(line.String(), "\n")
+			if h.dash {
+				l = strings.TrimLeft(l, "\t")
+			}
+			if l == h.delim {
+				break
+			}
+		}
+	}
+	return i, nil
+}
+
+// isWordEnd reports whether a word can end before or start after c.
+func isWordEnd(c byte) bool {
+	return isSpace(rune(c)) || strings.IndexByte(";&|()<>", c) >= 0
+}
+
+func formatArg(verb byte, arg interface{}) (string, error) {
+	if list, ok := arg.([]string); ok {
+		if verb != 'v' {
+			return "", fmt.Errorf("a []string needs %%v")
+		}
+		return Join(list), nil
+	}
+	switch verb {
+	case 'v', 's', 'd', 'x', 'X', 'o', 'f', 'g', 'e', 't':
+		s := fmt.Sprintf("%"+string(verb), arg)
+		if verb != 'v' && verb != 's' && strings.HasPrefix(s, "%!"+string(verb)+"(") {
+			return "", fmt.Errorf("wrong type %T", arg)
+		}
+		return Quote(s), nil
+	}
+	return "", fmt.Errorf("unknown verb")
+}
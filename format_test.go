@@ -0,0 +1,100 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	var tests = []struct {
+		format string
+		args   []interface{}
+		out    string
+	}{
+		{`git commit -m %s -- %s`, []interface{}{"it's done; rm -rf /", "a b.txt"}, `git commit -m 'it'\''s done; rm -rf /' -- 'a b.txt'`},
+		{`rm -- %v`, []interface{}{[]string{"a", "$(id)", ""}}, `rm -- a '$(id)' ''`},
+		{`ls %v`, []interface{}{[]string{}}, `ls `},
+		{`head -n %d %s>%s 2>&1`, []interface{}{10, "in", "out file"}, `head -n 10 in>'out file' 2>&1`},
+		{`(cd %s&&make)|tee %s`, []interface{}{"dir", "log"}, `(cd dir&&make)|tee log`},
+		{`echo '100%%' "%%" %%s`, nil, `echo '100%' "%" %s`},
+		{`echo %v %t`, []interface{}{3.5, true}, `echo 3.5 true`},
+		{"echo $'it\\'s' %s", []interface{}{"x"}, "echo $'it\\'s' x"},
+		{`echo \'%s`, []interface{}{"x"}, ""},
+		{`echo "a\"" %s`, []interface{}{"x y"}, `echo "a\"" 'x y'`},
+		{"cat <<EOF %s\n100%%\nEOF\necho %s", []interface{}{"a b", "c"}, "cat <<EOF 'a b'\n100%\nEOF\necho c"},
+		{"cat <<-'E' # c\n\t$x\n\tE\necho %s", []interface{}{"c"}, "cat <<-'E' # c\n\t$x\n\tE\necho c"},
+		{`(( n = 1 )) && echo $((2 * (3 + 1))) %s`, []interface{}{"x"}, `(( n = 1 )) && echo $((2 * (3 + 1))) x`},
+		{`cat <<<%s`, []interface{}{"a b"}, `cat <<<'a b'`},
+	}
+	for _, test := range tests {
+		out, err := Format(test.format, test.args...)
+		if test.out == "" {
+			if err == nil {
+				t.Fatalf("%q: Should be an error, but %q", test.format, out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", test.format, err)
+		}
+		if out != test.out {
+			t.Fatalf("%q: Expected %q, but %q", test.format, test.out, out)
+		}
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	var tests = []struct {
+		format string
+		args   []interface{}
+	}{
+		{`echo '%s'`, []interface{}{"x"}},
+		{`echo "%s"`, []interface{}{"x"}},
+		{"echo `%s`", []interface{}{"x"}},
+		{`echo $'%s'`, []interface{}{"x"}},
+		{`echo --name=%s`, []interface{}{"x"}},
+		{`echo %s.txt`, []interface{}{"x"}},
+		{`echo %s%s`, []interface{}{"x", "y"}},
+		{`echo # %s`, []interface{}{"x"}},
+		{`echo %s`, nil},
+		{`echo %s`, []interface{}{"x", "y"}},
+		{`echo %s`, []interface{}{[]string{"x"}}},
+		{`echo %d`, []interface{}{"x"}},
+		{`echo %`, nil},
+		{`echo %q`, []interface{}{"x"}},
+		{"cat <<EOF\n%s\nEOF", []interface{}{"$(echo PWNED >&2)"}},
+		{"cat <<'EOF'\n%s\nEOF", []interface{}{"x"}},
+		{"cat <<EOF; echo\na\nEOFX\n%s\nEOF", []interface{}{"x"}},
+		{"cat <<%s\nEOF", []interface{}{"EOF"}},
+		{`(( n = %s ))`, []interface{}{"x"}},
+		{`echo $(( %s ))`, []interface{}{"1"}},
+		{`echo $(( (1 + %s) ))`, []interface{}{"1"}},
+	}
+	for _, test := range tests {
+		if out, err := Format(test.format, test.args...); err == nil {
+			t.Fatalf("%q: Should be an error, but %q", test.format, out)
+		}
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	values := []string{"a b", "it's", `"$HOME"`, "*", "~", "#x", "", "\n", `\`}
+	line, err := Format("cmd %s %v -- %s", values[0], values[1:len(values)-1], values[len(values)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewParser()
+	p.ParseEnv = true
+	p.ParseGlob = true
+	p.ParseTilde = true
+	p.ParseComment = true
+	p.Escape = EscapePOSIX
+	args, err := p.Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]string{"cmd"}, values[:len(values)-1]...), "--", values[len(values)-1])
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %q, but %q", want, args)
+	}
+}
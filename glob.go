@@ -0,0 +1,411 @@
+package shellwords
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// GlobFlags changes how pathname expansion works, like the shell options
+// of the same names in bash.
+type GlobFlags int
+
+const (
+	// GlobNull removes patterns which match nothing instead of keeping
+	// them as they are.
+	GlobNull GlobFlags = 1 << iota
+
+	// GlobFail makes a pattern which matches nothing an error.
+	GlobFail
+
+	// GlobDot lets wildcards match a leading '.' of a file name.
+	GlobDot
+
+	// GlobStar makes ** match any number of directories.
+	GlobStar
+
+	// GlobExt enables the patterns ?(list), *(list), +(list), @(list)
+	// and !(list), where list is patterns separated by '|'.
+	GlobExt
+)
+
+// globPattern turns w into a pattern in which the special characters
+// which were quoted are escaped with a backslash.
+func globPattern(w word) string {
+	var b strings.Builder
+	for i := 0; i < w.len(); i++ {
+		c := w.s[i]
+		if w.mask[i] == quoted && strings.IndexByte(`*?[]\()|!@+`, c) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// glob expands the pattern into the sorted list of matching pathnames.
+// It returns nil if nothing matched.
+func (p *Parser) glob(pattern string) ([]string, error) {
+	ext := p.Glob&GlobExt != 0
+
+	// The directories before the first wildcard are where the matching
+	// starts, and are kept as they are written.
+	prefix, rest := "", pattern
+	for {
+		i := strings.IndexByte(rest, '/')
+		if i < 0 || hasGlobMeta(rest[:i], ext) {
+			break
+		}
+		prefix, rest = prefix+rest[:i+1], rest[i+1:]
+	}
+	prefix = unescapeGlob(prefix)
+
+	fsys := p.FS
+	if fsys == nil {
+		dir := filepath.FromSlash(prefix)
+		if !strings.HasPrefix(prefix, "/") && !filepath.IsAbs(dir) && p.Dir != "" {
+			dir = filepath.Join(p.Dir, dir)
+		}
+		if dir == "" {
+			dir = "."
+		}
+		fsys = os.DirFS(dir)
+	} else if prefix != "" {
+		// Absolute patterns and ones which go up are not in FS.
+		dir := path.Clean(prefix)
+		if !fs.ValidPath(dir) {
+			return nil, nil
+		}
+		var err error
+		if fsys, err = fs.Sub(fsys, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var comps []string
+	for _, comp := range strings.Split(rest, "/") {
+		if comp != "" {
+			comps = append(comps, comp)
+		}
+	}
+	dirOnly := strings.HasSuffix(rest, "/")
+
+	paths := []string{"."}
+	for i, comp := range comps {
+		last := i == len(comps)-1
+		var next []string
+		switch {
+		case comp == "**" && p.Glob&GlobStar != 0:
+			for _, base := range paths {
+				if !last {
+					next = append(next, base)
+				}
+				err := fs.WalkDir(fsys, base, func(name string, d fs.DirEntry, err error) error {
+					if err != nil || name == base {
+						return nil
+					}
+					if strings.HasPrefix(d.Name(), ".") && p.Glob&GlobDot == 0 {
+						if d.IsDir() {
+							return fs.SkipDir
+						}
+						return nil
+					}
+					if last || isDir(fsys, name, d) {
+						next = append(next, name)
+					}
+					return nil
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+		case !hasGlobMeta(comp, ext):
+			lit := unescapeGlob(comp)
+			for _, base := range paths {
+				name := path.Join(base, lit)
+				if last {
+					if _, err := fs.Stat(fsys, name); err != nil {
+						continue
+					}
+				}
+				next = append(next, name)
+			}
+		default:
+			for _, base := range paths {
+				entries, err := fs.ReadDir(fsys, base)
+				if err != nil {
+					continue
+				}
+				for _, d := range entries {
+					name := d.Name()
+					if name[0] == '.' && comp[0] != '.' && p.Glob&GlobDot == 0 {
+						continue
+					}
+					if !matchGlob(comp, name, ext) {
+						continue
+					}
+					full := path.Join(base, name)
+					if !last && !isDir(fsys, full, d) {
+						continue
+					}
+					next = append(next, full)
+				}
+			}
+		}
+		paths = next
+	}
+
+	var matches []string
+	for _, name := range paths {
+		if dirOnly {
+			if fi, err := fs.Stat(fsys, name); err != nil || !fi.IsDir() {
+				continue
+			}
+			name += "/"
+		}
+		matches = append(matches, prefix+name)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// expandGlob returns the words w expands to.
+func (p *Parser) expandGlob(w word, span Span) ([]string, error) {
+	pattern := globPattern(w)
+	if !hasGlobMeta(pattern, p.Glob&GlobExt != 0) {
+		return []string{w.s}, nil
+	}
+	matches, err := p.glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) > 0 {
+		return matches, nil
+	}
+	if p.Glob&GlobFail != 0 {
+		if err := p.fail(span, fmt.Errorf("no match: %s", w.s)); err != nil {
+			return nil, err
+		}
+	} else if p.Glob&GlobNull != 0 {
+		return nil, nil
+	}
+	return []string{w.s}, nil
+}
+
+func isDir(fsys fs.FS, name string, d fs.DirEntry) bool {
+	if d.IsDir() {
+		return true
+	}
+	if d.Type()&fs.ModeSymlink == 0 {
+		return false
+	}
+	fi, err := fs.Stat(fsys, name)
+	return err == nil && fi.IsDir()
+}
+
+func isExtGlob(pat string, i int) bool {
+	return i+1 < len(pat) && pat[i+1] == '(' && strings.IndexByte("?*+@!", pat[i]) >= 0
+}
+
+// hasGlobMeta reports whether pat has an unescaped wildcard.
+func hasGlobMeta(pat string, ext bool) bool {
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		default:
+			if ext && isExtGlob(pat, i) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unescapeGlob(pat string) string {
+	var b strings.Builder
+	for i := 0; i < len(pat); i++ {
+		if pat[i] == '\\' && i+1 < len(pat) {
+			i++
+		}
+		b.WriteByte(pat[i])
+	}
+	return b.String()
+}
+
+// matchGlob reports whether name matches the pattern pat. On a mismatch
+// the last '*' takes one more character and the rest is matched again, as
+// path.Match does, so only extended patterns backtrack further.
+func matchGlob(pat, name string, ext bool) bool {
+	var starPat, starName string
+	star := false
+	for len(pat) > 0 || len(name) > 0 {
+		if len(pat) > 0 && pat[0] == '*' && !(ext && isExtGlob(pat, 0)) {
+			for len(pat) > 0 && pat[0] == '*' && !(ext && isExtGlob(pat, 0)) {
+				pat = pat[1:]
+			}
+			star, starPat, starName = true, pat, name
+			continue
+		}
+		if len(pat) > 0 {
+			if alts, rest, ok := extGlobAt(pat, ext); ok {
+				if matchExtGlob(pat[0], alts, rest, name) {
+					return true
+				}
+			} else if p, n, ok := matchChar(pat, name); ok {
+				pat, name = p, n
+				continue
+			}
+		}
+		if !star || starName == "" {
+			return false
+		}
+		_, n := utf8.DecodeRuneInString(starName)
+		starName = starName[n:]
+		pat, name = starPat, starName
+	}
+	return true
+}
+
+// matchChar matches the first character of name against the start of pat
+// and returns what is left of both.
+func matchChar(pat, name string) (string, string, bool) {
+	if name == "" {
+		return "", "", false
+	}
+	r, n := utf8.DecodeRuneInString(name)
+	switch pat[0] {
+	case '?':
+		return pat[1:], name[n:], true
+	case '[':
+		if matched, width, ok := matchClass(pat, r); ok {
+			return pat[width:], name[n:], matched
+		}
+	case '\\':
+		if len(pat) > 1 {
+			pat = pat[1:]
+		}
+	}
+	if pat[0] != name[0] {
+		return "", "", false
+	}
+	return pat[1:], name[1:], true
+}
+
+func byteAt(s string, i int) byte {
+	if i == len(s) {
+		return 0
+	}
+	return s[i]
+}
+
+// matchClass matches r against the bracket expression at the start of
+// pat. ok is false if pat doesn't start with a complete one, in which case
+// '[' is an ordinary character.
+func matchClass(pat string, r rune) (matched bool, width int, ok bool) {
+	i := 1
+	negate := false
+	if i < len(pat) && (pat[i] == '!' || pat[i] == '^') {
+		negate = true
+		i++
+	}
+	first := true
+	for i < len(pat) {
+		if pat[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+		first = false
+		lo, n := classChar(pat[i:])
+		i += n
+		hi := lo
+		if i+1 < len(pat) && pat[i] == '-' && pat[i+1] != ']' {
+			hi, n = classChar(pat[i+1:])
+			i += 1 + n
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+	return false, 0, false
+}
+
+func classChar(s string) (rune, int) {
+	if s[0] == '\\' && len(s) > 1 {
+		r, n := utf8.DecodeRuneInString(s[1:])
+		return r, n + 1
+	}
+	return utf8.DecodeRuneInString(s)
+}
+
+// extGlobAt splits the extended pattern at the start of pat, if ext is
+// true and there is one.
+func extGlobAt(pat string, ext bool) (alts []string, rest string, ok bool) {
+	if !ext || !isExtGlob(pat, 0) {
+		return nil, "", false
+	}
+	return splitExtGlob(pat[1:])
+}
+
+// splitExtGlob splits "(a|b)rest" into its alternatives and the rest.
+func splitExtGlob(pat string) (alts []string, rest string, ok bool) {
+	depth := 0
+	last := 1
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case '|':
+			if depth == 1 {
+				alts = append(alts, pat[last:i])
+				last = i + 1
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return append(alts, pat[last:i]), pat[i+1:], true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func matchExtGlob(op byte, alts []string, rest, name string) bool {
+	matchAny := func(s string) bool {
+		for _, alt := range alts {
+			if matchGlob(alt, s, true) {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i <= len(name); i++ {
+		if !utf8.RuneStart(byteAt(name, i)) {
+			continue
+		}
+		head, tail := name[:i], name[i:]
+		switch op {
+		case '@', '?':
+			if matchAny(head) && matchGlob(rest, tail, true) {
+				return true
+			}
+		case '+', '*':
+			if matchAny(head) && (matchGlob(rest, tail, true) || i > 0 && matchExtGlob('+', alts, rest, tail)) {
+				return true
+			}
+		case '!':
+			if !matchAny(head) && matchGlob(rest, tail, true) {
+				return true
+			}
+		}
+	}
+	return (op == '?' || op == '*') && matchGlob(rest, name, true)
+}
@@ -0,0 +1,153 @@
+package shellwords
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var globFS = fstest.MapFS{
+	"a.txt":          {},
+	"b.txt":          {},
+	"c.md":           {},
+	".hidden.txt":    {},
+	"out/x.txt":      {},
+	"out/sub/y.txt":  {},
+	"out/.git/z.txt": {},
+	"[x].txt":        {},
+	"foo.c":          {},
+	"bar.c":          {},
+	"foobar.c":       {},
+}
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		line     string
+		flags    GlobFlags
+		expected []string
+	}{
+		{`cp *.txt out/`, 0, []string{"cp", "[x].txt", "a.txt", "b.txt", "out/"}},
+		{`ls ?.* [ab].txt [!a].txt`, 0, []string{"ls", "a.txt", "b.txt", "c.md", "a.txt", "b.txt", "b.txt"}},
+		{`ls '*.txt' "?.md" \*.c *.none`, 0, []string{"ls", "*.txt", "?.md", "*.c", "*.none"}},
+		{`ls *.none x`, GlobNull, []string{"ls", "x"}},
+		{`ls .*.txt`, 0, []string{"ls", ".hidden.txt"}},
+		{`ls *.txt`, GlobDot, []string{"ls", ".hidden.txt", "[x].txt", "a.txt", "b.txt"}},
+		{`ls */ out/*/*.txt`, 0, []string{"ls", "out/", "out/sub/y.txt"}},
+		{`ls **/*.txt`, GlobStar, []string{"ls", "[x].txt", "a.txt", "b.txt", "out/sub/y.txt", "out/x.txt"}},
+		{`ls out/**`, GlobStar, []string{"ls", "out/sub", "out/sub/y.txt", "out/x.txt"}},
+		{`ls \[x\].txt '[x]'.txt`, 0, []string{"ls", "[x].txt", "[x].txt"}},
+		{`ls @(foo|bar).c !(foo).c +(foo|bar).c`, GlobExt, []string{"ls", "bar.c", "foo.c", "bar.c", "foobar.c", "bar.c", "foo.c", "foobar.c"}},
+		{`ls *(x) ?(a|b).txt`, GlobExt, []string{"ls", "*(x)", "a.txt", "b.txt"}},
+		{`ls ./*.md out/./*.txt /*.md ../*.md`, 0, []string{"ls", "./c.md", "out/./x.txt", "/*.md", "../*.md"}},
+	}
+	for _, mode := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+		for _, tt := range tests {
+			parser := NewParser()
+			parser.Escape = mode
+			parser.ParseGlob = true
+			parser.Glob = tt.flags
+			parser.FS = globFS
+			args, err := parser.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("%q: %v", tt.line, err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Fatalf("Expected %#v for %q, but %#v:", tt.expected, tt.line, args)
+			}
+		}
+	}
+}
+
+func TestGlobFail(t *testing.T) {
+	parser := NewParser()
+	parser.ParseGlob = true
+	parser.Glob = GlobFail
+	parser.FS = globFS
+	if _, err := parser.Parse(`ls *.none`); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if _, err := parser.Parse(`ls *.md`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pat, name string
+		ext       bool
+		expected  bool
+	}{
+		{`*`, ``, false, true},
+		{`a*b*c`, `aXbYbc`, false, true},
+		{`a*b*c`, `aXbYbcd`, false, false},
+		{`*.go`, `a.go.txt`, false, false},
+		{`?é*`, `aé`, false, true},
+		{`*\*`, `a*`, false, true},
+		{`*@(a|b)`, `xb`, true, true},
+		{`*@(a|b)x`, `xbxy`, true, false},
+		{strings.Repeat(`*a`, 20) + `*b`, strings.Repeat(`a`, 100), false, false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pat, tt.name, tt.ext); got != tt.expected {
+			t.Fatalf("Expected %v for %q and %q, but %v", tt.expected, tt.pat, tt.name, got)
+		}
+	}
+}
+
+func TestGlobAfterEnv(t *testing.T) {
+	for _, mode := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+		parser := NewParser()
+		parser.Escape = mode
+		parser.ParseEnv = true
+		parser.ParseGlob = true
+		parser.FS = globFS
+		parser.Getenv = func(k string) string { return map[string]string{"PAT": "*.md"}[k] }
+		args, err := parser.Parse(`ls $PAT`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"ls", "c.md"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Fatalf("Expected %#v, but %#v:", expected, args)
+		}
+	}
+}
+
+func TestGlobDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parser := NewParser()
+	parser.ParseGlob = true
+	parser.Dir = dir
+	args, err := parser.Parse(`go vet *.go`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"go", "vet", "a.go", "b.go"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, args)
+	}
+
+	parser.Dir = filepath.Join(dir, "sub")
+	if args, err = parser.Parse(`ls ../*.txt`); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"ls", "../c.txt"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, args)
+	}
+	if args, err = parser.Parse(`ls ` + filepath.ToSlash(dir) + `/*.txt`); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"ls", filepath.ToSlash(dir) + "/c.txt"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, args)
+	}
+}
@@ -0,0 +1,366 @@
+package shellwords
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// History is the list of the lines entered before, for history expansion.
+// Events are numbered from 1 to Len(), the last being the most recent.
+type History interface {
+	Len() int
+	Event(n int) string
+}
+
+// HistoryList is a History kept in a slice.
+type HistoryList []string
+
+func (h HistoryList) Len() int           { return len(h) }
+func (h HistoryList) Event(n int) string { return h[n-1] }
+
+// HistoryPrintError is returned by Parse when the line used the :p
+// modifier. Line is the expanded line, which is to be shown but not run.
+type HistoryPrintError struct {
+	Line string
+}
+
+func (e *HistoryPrintError) Error() string {
+	return "history expansion to be printed only: " + e.Line
+}
+
+var errNoPreviousSubst = errors.New("no previous substitution")
+
+// ExpandHistory performs history expansion on line, like bash does with
+// the lines typed in an interactive shell. print is true if the :p
+// modifier was used, in which case the line is to be shown but not run.
+func (p *Parser) ExpandHistory(line string) (expanded string, print bool, err error) {
+	return p.expandHistory(line, nil)
+}
+
+func (p *Parser) expandHistory(line string, regions *[]region) (string, bool, error) {
+	var b strings.Builder
+	print := false
+	last := 0
+	add := func(start, end int, s string, pr bool) {
+		b.WriteString(line[last:start])
+		r := region{Start: b.Len(), Span: Span{Start: start, End: end}}
+		b.WriteString(s)
+		r.End = b.Len()
+		if regions != nil {
+			*regions = append(*regions, r)
+		}
+		last = end
+		print = print || pr
+	}
+
+	i := 0
+	if strings.HasPrefix(line, "^") {
+		// ^old^new^ is !!:s^old^new^.
+		event, err := p.historyEvent(p.historyLen(), "^")
+		if err != nil {
+			return "", false, err
+		}
+		s, end, err := historySubst(event, line, 0, false)
+		if err != nil {
+			return "", false, err
+		}
+		s, end, pr, err := historyModifiers(s, line, end)
+		if err != nil {
+			return "", false, err
+		}
+		add(0, end, s, pr)
+		i = end
+	}
+
+	doubleQuoted := false
+	for i < len(line) {
+		switch c := line[i]; {
+		case c == '\'' && !doubleQuoted:
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				i = len(line)
+			} else {
+				i += end + 2
+			}
+			continue
+		case c == '"':
+			doubleQuoted = !doubleQuoted
+		case c == '\\':
+			i += 2
+			continue
+		case c == '!' && i+1 < len(line) && strings.IndexByte(" \t\r\n=(", line[i+1]) < 0 && !(doubleQuoted && line[i+1] == '"'):
+			s, end, pr, err := p.historyRef(line, i)
+			if err != nil {
+				return "", false, err
+			}
+			add(i, end, s, pr)
+			i = end
+			continue
+		}
+		i++
+	}
+	b.WriteString(line[last:])
+	return b.String(), print, nil
+}
+
+func (p *Parser) historyLen() int {
+	if p.History == nil {
+		return 0
+	}
+	return p.History.Len()
+}
+
+func (p *Parser) historyEvent(n int, ref string) (string, error) {
+	if n < 1 || n > p.historyLen() {
+		return "", fmt.Errorf("%s: event not found", ref)
+	}
+	return p.History.Event(n), nil
+}
+
+// historyRef expands the history reference which starts with the '!' at i.
+func (p *Parser) historyRef(line string, i int) (string, int, bool, error) {
+	j := i + 1
+	n := p.historyLen()
+	var search func(string) bool
+	switch c := line[j]; {
+	case c == '!':
+		j++
+	case c == '-' && j+1 < len(line) && isDigit(line[j+1]), isDigit(c):
+		k := j + 1
+		for k < len(line) && isDigit(line[k]) {
+			k++
+		}
+		v, err := strconv.Atoi(line[j:k])
+		if err != nil {
+			return "", 0, false, fmt.Errorf("%s: event not found", line[i:k])
+		}
+		if v < 0 {
+			n += v + 1
+		} else {
+			n = v
+		}
+		j = k
+	case c == '?':
+		k := j + 1
+		for k < len(line) && line[k] != '?' && line[k] != '\n' {
+			k++
+		}
+		str := line[j+1 : k]
+		search = func(event string) bool { return strings.Contains(event, str) }
+		if k < len(line) && line[k] == '?' {
+			k++
+		}
+		j = k
+	case strings.IndexByte("^$*:%", c) >= 0:
+		// A word designator alone refers to the previous line.
+	default:
+		k := j
+		for k < len(line) && strings.IndexByte(" \t\r\n:;&|<>()\"'", line[k]) < 0 {
+			k++
+		}
+		str := line[j:k]
+		search = func(event string) bool { return strings.HasPrefix(event, str) }
+		j = k
+	}
+	if search != nil {
+		for ; n > 0; n-- {
+			if search(p.History.Event(n)) {
+				break
+			}
+		}
+	}
+	event, err := p.historyEvent(n, line[i:j])
+	if err != nil {
+		return "", 0, false, err
+	}
+	s, j, err := historyWords(event, line, j)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return historyModifiers(s, line, j)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// historyWords selects the words of event given by the word designator at
+// j, if there is one.
+func historyWords(event, line string, j int) (string, int, error) {
+	start := j
+	switch {
+	case j < len(line) && strings.IndexByte("^$*%", line[j]) >= 0:
+	case j+1 < len(line) && line[j] == ':' && (isDigit(line[j+1]) || strings.IndexByte("^$*-%", line[j+1]) >= 0):
+		j++
+	default:
+		return event, j, nil
+	}
+
+	var words []string
+	lx := &scriptLexer{p: &Parser{}, src: event}
+	for {
+		t, err := lx.scan()
+		if err != nil {
+			words = strings.Fields(event)
+			break
+		}
+		if t.kind == tEOF {
+			break
+		}
+		if t.val != "\n" {
+			words = append(words, t.val)
+		}
+	}
+	lastWord := len(words) - 1
+
+	bad := func() (string, int, error) {
+		return "", 0, fmt.Errorf("%s: bad word specifier", line[start:j])
+	}
+	word := func() (int, bool) {
+		switch {
+		case j < len(line) && line[j] == '^':
+			j++
+			return 1, true
+		case j < len(line) && line[j] == '$':
+			j++
+			return lastWord, true
+		case j < len(line) && isDigit(line[j]):
+			k := j
+			for j < len(line) && isDigit(line[j]) {
+				j++
+			}
+			n, err := strconv.Atoi(line[k:j])
+			return n, err == nil
+		}
+		return 0, false
+	}
+
+	var x, y int
+	switch {
+	case line[j] == '*':
+		j++
+		if lastWord < 1 {
+			return "", j, nil
+		}
+		x, y = 1, lastWord
+	case line[j] == '%':
+		j++
+		return bad()
+	default:
+		var ok bool
+		if line[j] != '-' {
+			if x, ok = word(); !ok {
+				j++
+				return bad()
+			}
+		}
+		y = x
+		switch {
+		case j < len(line) && line[j] == '*':
+			j++
+			y = lastWord
+		case j < len(line) && line[j] == '-':
+			j++
+			if y, ok = word(); !ok {
+				y = lastWord - 1
+			}
+		}
+	}
+	if x < 0 || y > lastWord || x > y {
+		return bad()
+	}
+	return strings.Join(words[x:y+1], " "), j, nil
+}
+
+// historyModifiers applies the modifiers at j to s.
+func historyModifiers(s, line string, j int) (string, int, bool, error) {
+	print := false
+	for j+1 < len(line) && line[j] == ':' {
+		global := false
+		k := j + 1
+		if line[k] == 'g' || line[k] == 'a' {
+			global = true
+			k++
+		}
+		if k == len(line) {
+			break
+		}
+		switch line[k] {
+		case 'h':
+			if i := strings.LastIndexByte(s, '/'); i >= 0 {
+				s = s[:i]
+			}
+		case 't':
+			if i := strings.LastIndexByte(s, '/'); i >= 0 {
+				s = s[i+1:]
+			}
+		case 'r':
+			if i := strings.LastIndexByte(s, '.'); i > strings.LastIndexByte(s, '/') {
+				s = s[:i]
+			}
+		case 'e':
+			if i := strings.LastIndexByte(s, '.'); i > strings.LastIndexByte(s, '/') {
+				s = s[i:]
+			} else {
+				s = ""
+			}
+		case 'p':
+			print = true
+		case 's':
+			if k+1 == len(line) {
+				return "", 0, false, fmt.Errorf("%s: bad modifier", line[j:])
+			}
+			var err error
+			if s, j, err = historySubst(s, line, k+1, global); err != nil {
+				return "", 0, false, err
+			}
+			continue
+		default:
+			if global {
+				return "", 0, false, fmt.Errorf("%s: unrecognized history modifier", line[j:k+1])
+			}
+			// Not a modifier, like the colon of a:b.
+			return s, j, print, nil
+		}
+		j = k + 1
+	}
+	return s, j, print, nil
+}
+
+// historySubst applies the substitution delimited by line[d] to s, as in
+// s/old/new/. An & in new stands for old. The last delimiter is optional at
+// the end of line.
+func historySubst(s, line string, d int, global bool) (string, int, error) {
+	delim := line[d]
+	j := d + 1
+	part := func() string {
+		var b strings.Builder
+		for ; j < len(line) && line[j] != delim && line[j] != '\n'; j++ {
+			if line[j] == '\\' && j+1 < len(line) && line[j+1] == delim {
+				j++
+			}
+			b.WriteByte(line[j])
+		}
+		if j < len(line) && line[j] == delim {
+			j++
+		}
+		return b.String()
+	}
+	old := part()
+	repl := part()
+	if old == "" {
+		return "", 0, errNoPreviousSubst
+	}
+	repl = strings.Replace(strings.Replace(repl, `\&`, "\x00", -1), "&", old, -1)
+	repl = strings.Replace(repl, "\x00", "&", -1)
+	if !strings.Contains(s, old) {
+		return "", 0, fmt.Errorf("%s: substitution failed", line[d:j])
+	}
+	n := 1
+	if global {
+		n = -1
+	}
+	return strings.Replace(s, old, repl, n), j, nil
+}
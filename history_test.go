@@ -0,0 +1,102 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testHistory = HistoryList{
+	"make -C src all",
+	"cp /usr/local/lib/libfoo.so.1 /tmp/foo.tar.gz",
+	`echo 'a b' "c d" e`,
+	"git commit -m fix",
+}
+
+func TestExpandHistory(t *testing.T) {
+	var tests = []struct {
+		line string
+		want string
+	}{
+		{`!!`, `git commit -m fix`},
+		{`sudo !! --amend`, `sudo git commit -m fix --amend`},
+		{`!1`, `make -C src all`},
+		{`!-2`, `echo 'a b' "c d" e`},
+		{`!ma`, `make -C src all`},
+		{`!?local?:t`, `foo.tar.gz`},
+		{`!?src`, `make -C src all`},
+		{`ls !$`, `ls fix`},
+		{`ls !^`, `ls commit`},
+		{`ls !*`, `ls commit -m fix`},
+		{`!3:0 !3:2-3`, `echo "c d" e`},
+		{`!3:1*`, `'a b' "c d" e`},
+		{`!3:-1`, `echo 'a b'`},
+		{`!3:1-`, `'a b' "c d"`},
+		{`!2:1:h`, `/usr/local/lib`},
+		{`!2:1:t:r`, `libfoo.so`},
+		{`!2:$:e`, `.gz`},
+		{`!2:$:r:r`, `/tmp/foo`},
+		{`!1:s/all/clean/`, `make -C src clean`},
+		{`!1:gs/l/L`, `make -C src aLL`},
+		{`!!:s/fix/& it/`, `git commit -m fix it`},
+		{`^fix^bug`, `git commit -m bug`},
+		{`^fix^bug^ -q`, `git commit -m bug -q`},
+		{`echo '!!' \!! "!!"`, `echo '!!' \!! "git commit -m fix"`},
+		{`echo ! != !( "a!"`, `echo ! != !( "a!"`},
+		{`a:b !1:x`, `a:b make -C src all:x`},
+	}
+	parser := NewParser()
+	parser.History = testHistory
+	for _, test := range tests {
+		got, print, err := parser.ExpandHistory(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if print || got != test.want {
+			t.Fatalf("%q: Expected %q, but %q", test.line, test.want, got)
+		}
+	}
+
+	got, print, err := parser.ExpandHistory(`!1:p`)
+	if err != nil || !print || got != "make -C src all" {
+		t.Fatalf("Expected %q to print, but %q %v %v", "make -C src all", got, print, err)
+	}
+
+	for _, line := range []string{`!9`, `!-9`, `!nothing`, `!?nothing?`, `!1:9`, `!1:3-1`, `!1:s/x/y/`, `^zz^y`, `!1:%`} {
+		if _, _, err := parser.ExpandHistory(line); err == nil {
+			t.Fatalf("%q: Should be an error", line)
+		}
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+	parser := NewParser()
+	parser.ParseHistory = true
+	parser.History = testHistory
+	line := `echo !3:1 ok`
+	tokens, err := parser.ParseTokens(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Token{
+		{Kind: TokenWord, Value: "echo", Span: Span{0, 4}},
+		{Kind: TokenWord, Value: "a b", Span: Span{5, 9}},
+		{Kind: TokenWord, Value: "ok", Span: Span{10, 12}},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, tokens)
+	}
+
+	parser.Aliases = map[string]string{"git": "git -P"}
+	args, err := parser.Parse(`!!`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"git", "-P", "commit", "-m", "fix"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v", want, args)
+	}
+
+	_, err = parser.Parse(`!!:p`)
+	if e, ok := err.(*HistoryPrintError); !ok || e.Line != "git commit -m fix" {
+		t.Fatalf("Expected *HistoryPrintError, but %v", err)
+	}
+}
@@ -0,0 +1,726 @@
+package shellwords
+
+import (
+	"strings"
+)
+
+// Invocation is a command of a line. Children are the commands it runs
+// too, found the same way: first those of the command substitutions,
+// backquotes and process substitutions in its words, then, if it runs a
+// script with an interpreter, like bash -c 'cd /srv && ./run', the
+// commands of that script.
+type Invocation struct {
+	// Args is empty for a command of only assignments or for the words of
+	// a compound command, like case $(cmd) in, which has substitutions.
+	Args []string
+	// Spans are where each of Args is written in the line given to
+	// ParseInvocation, its quotes included. The words in a script which
+	// came from an expansion all have the span of the word of the script.
+	Spans []Span
+
+	// Shell is the interpreter, such as "bash", "cmd", "powershell" or
+	// "ssh", if the command runs Script with it.
+	Shell    string
+	Script   string
+	Children []*Invocation
+}
+
+// ParseInvocation parses line like ParseTokens and looks into the scripts
+// which the command runs: the one of -c for sh, bash, zsh, dash, ksh, ash
+// and busybox sh, of /c or /k for cmd, of -Command for powershell and
+// pwsh, and the remote command of ssh. Wrappers known by Unwrap are
+// skipped to find them, as in sudo sh -c '...'. The scripts of POSIX
+// shells are read by ParseScript; those of cmd and PowerShell are only
+// split into commands and words at their operators, quotes and escapes.
+//
+// line is one simple command. If ParseTokens stops before its end, at an
+// operator such as && or a redirection, it is an *UnsupportedError rather
+// than the rest being left out.
+func (p *Parser) ParseInvocation(line string) (*Invocation, error) {
+	tokens, err := p.ParseTokens(line)
+	if err != nil {
+		return nil, err
+	}
+	if p.Position >= 0 {
+		construct := "list"
+		switch rest := line[p.Position:]; {
+		case strings.HasPrefix(rest, "&&"), strings.HasPrefix(rest, "||"):
+			construct = "and-or list"
+		case strings.HasPrefix(rest, "|"):
+			construct = "pipeline"
+		case strings.HasPrefix(rest, "<"), strings.HasPrefix(rest, ">"):
+			construct = "redirection"
+		}
+		return nil, &UnsupportedError{Construct: construct, Span: Span{Start: p.Position, End: len(line)}}
+	}
+	src := literal(line)
+	var cmd command
+	for _, t := range tokens {
+		if t.Kind == TokenComment {
+			continue
+		}
+		raw := src.slice(t.Span.Start, t.Span.End)
+		cmd.subst = append(cmd.subst, substitutions(raw, false)...)
+		if v := unquotePOSIX(raw); v.s == t.Value {
+			cmd.args = append(cmd.args, arg{v, t.Span})
+		} else {
+			cmd.args = append(cmd.args, arg{coarse(t.Value, t.Span), t.Span})
+		}
+	}
+	return p.invocation(cmd)
+}
+
+// ParseInvocation parses line with the default parser. See
+// Parser.ParseInvocation.
+func ParseInvocation(line string) (*Invocation, error) {
+	return NewParser().ParseInvocation(line)
+}
+
+// mapped is a string with the span in the outer line of each of its bytes.
+// at has one more element, an empty span where the string ends.
+type mapped struct {
+	s  string
+	at []Span
+}
+
+// arg is an argument of a command and the span of the word it came from.
+type arg struct {
+	mapped
+	span Span
+}
+
+// command is a command found in a line or a script: its arguments, and
+// the scripts of the substitutions in its words, which run on another host
+// if remote is true.
+type command struct {
+	args   []arg
+	subst  []mapped
+	remote bool
+}
+
+func literal(s string) mapped {
+	m := mapped{s: s, at: make([]Span, len(s)+1)}
+	for i := range m.at {
+		m.at[i] = Span{Start: i, End: i + 1}
+	}
+	m.at[len(s)].End = len(s)
+	return m
+}
+
+// coarse maps each byte of s to all of span.
+func coarse(s string, span Span) mapped {
+	m := mapped{s: s, at: make([]Span, len(s)+1)}
+	for i := range m.at {
+		m.at[i] = span
+	}
+	m.at[len(s)] = Span{Start: span.End, End: span.End}
+	return m
+}
+
+func (m mapped) slice(start, end int) mapped {
+	at := append([]Span(nil), m.at[start:end]...)
+	return mapped{s: m.s[start:end], at: append(at, Span{Start: m.at[end].Start, End: m.at[end].Start})}
+}
+
+// span returns the span in the outer line of m.s[start:end].
+func (m mapped) span(start, end int) Span {
+	if start == end {
+		return Span{Start: m.at[start].Start, End: m.at[start].Start}
+	}
+	return Span{Start: m.at[start].Start, End: m.at[end-1].End}
+}
+
+// builder builds a mapped string a byte at a time.
+type builder struct {
+	mapped
+}
+
+func (b *builder) add(c byte, at Span) {
+	b.s += string([]byte{c})
+	b.at = append(b.at, at)
+}
+
+func (b *builder) done(end Span) mapped {
+	m := mapped{s: b.s, at: append(b.at, Span{Start: end.Start, End: end.Start})}
+	b.mapped = mapped{}
+	return m
+}
+
+// join joins args with spaces, as the programs which take a script in
+// several arguments do.
+func join(args []arg) mapped {
+	var b builder
+	for i, a := range args {
+		if i > 0 {
+			b.add(' ', args[i-1].span)
+		}
+		b.s += a.s
+		b.at = append(b.at, a.at[:len(a.s)]...)
+	}
+	return b.done(args[len(args)-1].at[len(args[len(args)-1].s)])
+}
+
+// unquotePOSIX removes the quotes and backslashes of the POSIX word raw.
+// Expansions are left as they are written, so the callers compare the
+// result with the value the parser gives the word.
+func unquotePOSIX(raw mapped) mapped {
+	var b builder
+	s := raw.s
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i++; i < len(s) && s[i] != '\n' {
+				b.add(s[i], raw.at[i])
+			}
+		case '\'':
+			for i++; i < len(s) && s[i] != '\''; i++ {
+				b.add(s[i], raw.at[i])
+			}
+		case '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					if i++; s[i] == '\n' {
+						continue
+					}
+				}
+				b.add(s[i], raw.at[i])
+			}
+		default:
+			b.add(c, raw.at[i])
+		}
+	}
+	return b.done(raw.at[len(s)])
+}
+
+func (p *Parser) invocation(cmd command) (*Invocation, error) {
+	inv := &Invocation{}
+	for _, a := range cmd.args {
+		inv.Args = append(inv.Args, a.s)
+		inv.Spans = append(inv.Spans, a.span)
+	}
+	add := func(cmds []command) error {
+		for _, c := range cmds {
+			child, err := p.invocation(c)
+			if err != nil {
+				return err
+			}
+			inv.Children = append(inv.Children, child)
+		}
+		return nil
+	}
+
+	for _, script := range cmd.subst {
+		cmds, err := p.splitPOSIX(script, cmd.remote)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(cmds); err != nil {
+			return nil, err
+		}
+	}
+
+	shell, start, rest := scriptArg(inv.Args)
+	if shell == "" {
+		return inv, nil
+	}
+	script := cmd.args[start].mapped
+	if rest {
+		script = join(cmd.args[start:])
+	}
+	inv.Shell, inv.Script = shell, script.s
+
+	var cmds []command
+	var err error
+	switch shell {
+	case "cmd":
+		cmds = commands(splitCmd(script))
+	case "powershell", "pwsh":
+		cmds = commands(splitPowerShell(script))
+	default:
+		cmds, err = p.splitPOSIX(script, cmd.remote || shell == "ssh")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := add(cmds); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// commands returns the commands with the arguments of each of cmds.
+func commands(cmds [][]arg) []command {
+	var r []command
+	for _, args := range cmds {
+		r = append(r, command{args: args})
+	}
+	return r
+}
+
+// substitutions returns the scripts of the command substitutions,
+// backquotes and process substitutions in the POSIX word raw, and of those
+// in its arithmetic expansions. Quotes are not special if heredoc is true,
+// as in a here-document.
+func substitutions(raw mapped, heredoc bool) []mapped {
+	var scripts []mapped
+	s := raw.s
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '\'' && !quoted && !heredoc:
+			if end := strings.IndexByte(s[i+1:], '\''); end >= 0 {
+				i += end + 1
+			}
+		case c == '"' && !heredoc:
+			quoted = !quoted
+		case c == '`':
+			// Backslashes before $, ` and \ are taken off in it.
+			var b builder
+			j := i + 1
+			for ; j < len(s) && s[j] != '`'; j++ {
+				if s[j] == '\\' && j+1 < len(s) && strings.IndexByte("$`\\", s[j+1]) >= 0 {
+					j++
+				}
+				b.add(s[j], raw.at[j])
+			}
+			if j < len(s) {
+				scripts = append(scripts, b.done(raw.at[j]))
+			}
+			i = j
+		case (c == '$' || (c == '<' || c == '>') && i == 0) && i+1 < len(s) && s[i+1] == '(':
+			end := parenEnd(s, i+1)
+			if end < 0 {
+				break
+			}
+			if c == '$' && s[i+2] == '(' && s[end-2] == ')' {
+				scripts = append(scripts, substitutions(raw.slice(i+3, end-2), heredoc)...)
+			} else {
+				scripts = append(scripts, raw.slice(i+2, end-1))
+			}
+			i = end - 1
+		}
+	}
+	return scripts
+}
+
+// sshSpec is for the options of ssh, before the host.
+var sshSpec = WrapperSpec{ShortArgs: "BbcDEeFIiJLlmOopQRSWw", Operands: 1}
+
+// scriptArg finds the script which args runs with an interpreter. It
+// returns the name of the interpreter and the index of the script in args,
+// which goes on to the end of args if rest is true.
+func scriptArg(args []string) (shell string, start int, rest bool) {
+	i := 0
+	for i < len(args) && isAssignment(args[i]) {
+		i++
+	}
+	i = len(args) - len(Unwrap(args[i:]).Args)
+	if i == len(args) {
+		return "", 0, false
+	}
+	name := args[i]
+	if j := strings.LastIndexAny(name, `/\`); j >= 0 {
+		name = name[j+1:]
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+	if name == "busybox" && i+1 < len(args) && (args[i+1] == "sh" || args[i+1] == "ash") {
+		i++
+		name = args[i]
+	}
+
+	switch name {
+	case "sh", "bash", "zsh", "dash", "ksh", "mksh", "ash":
+		c := false
+		j := i + 1
+		for ; j < len(args); j++ {
+			a := args[j]
+			if a == "--" || a == "-" {
+				j++
+				break
+			}
+			if strings.HasPrefix(a, "--") {
+				if a == "--rcfile" || a == "--init-file" {
+					j++
+				}
+				continue
+			}
+			if len(a) < 2 || a[0] != '-' && a[0] != '+' {
+				break
+			}
+			if a[0] == '-' && strings.IndexByte(a, 'c') >= 0 {
+				c = true
+			}
+			if strings.IndexAny(a, "oO") >= 0 {
+				j++
+			}
+		}
+		if c && j < len(args) {
+			return name, j, false
+		}
+	case "cmd":
+		for j := i + 1; j < len(args) && strings.HasPrefix(args[j], "/"); j++ {
+			if strings.EqualFold(args[j], "/c") || strings.EqualFold(args[j], "/k") {
+				if j+1 < len(args) {
+					return name, j + 1, true
+				}
+				break
+			}
+		}
+	case "powershell", "pwsh":
+		for j := i + 1; j < len(args); j++ {
+			a := args[j]
+			if a == "-" {
+				break
+			}
+			if a == "" || a[0] != '-' && a[0] != '/' {
+				// powershell runs the words left as a command, pwsh as a
+				// file.
+				if name == "powershell" {
+					return name, j, true
+				}
+				break
+			}
+			opt := strings.ToLower(strings.TrimLeft(a, "-/"))
+			if opt == "c" || len(opt) >= 3 && strings.HasPrefix("command", opt) {
+				if j+1 < len(args) {
+					return name, j + 1, true
+				}
+				break
+			}
+			if opt == "f" || opt == "e" || opt == "ec" || strings.HasPrefix("file", opt) || strings.HasPrefix("encodedcommand", opt) {
+				break
+			}
+			switch opt {
+			case "executionpolicy", "ep", "ex", "windowstyle", "w", "inputformat", "if", "inp", "outputformat", "of", "o",
+				"configurationname", "workingdirectory", "wd", "settingsfile", "custompipename", "version", "v", "psconsolefile":
+				j++
+			}
+		}
+	case "ssh":
+		var u Unwrapped
+		if _, n := u.unwrap(sshSpec, args[i:]); i+n < len(args) {
+			return name, i + n, true
+		}
+	}
+	return "", 0, false
+}
+
+// splitPOSIX returns the simple commands of a POSIX script. Nothing in it
+// is run or assigned here: substitutions and globs are left as written, and
+// so are variables and ~ if the script runs on another host.
+func (p *Parser) splitPOSIX(script mapped, remote bool) ([]command, error) {
+	q := *p
+	q.Aliases = nil
+	q.ParseHistory = false
+	q.RejectUnsupported = false
+	q.Tolerant = false
+	q.ParseBacktick = false
+	q.ProcSubst = nil
+	q.ParseGlob = false
+	q.Setenv = nil
+	if remote {
+		q.ParseEnv = false
+		q.ParseTilde = false
+	}
+	list, err := q.ParseScript(script.s)
+	if err != nil {
+		if e, ok := err.(*SyntaxError); ok {
+			return nil, &SyntaxError{Span: script.span(e.Span.Start, e.Span.End), Msg: e.Msg}
+		}
+		return nil, err
+	}
+
+	var cmds []command
+	// subst returns the scripts of the substitutions in words and in the
+	// targets and here-documents of redirs.
+	subst := func(words []*Word, redirs []*Redirect) []mapped {
+		var scripts []mapped
+		for _, w := range words {
+			scripts = append(scripts, substitutions(script.slice(w.Span.Start, w.Span.End), false)...)
+		}
+		for _, r := range redirs {
+			scripts = append(scripts, substitutions(script.slice(r.Target.Span.Start, r.Target.Span.End), false)...)
+			if (r.Op == "<<" || r.Op == "<<-") && !r.HeredocQuoted {
+				body := coarse(r.Heredoc, script.span(r.Span.Start, r.Span.End))
+				scripts = append(scripts, substitutions(body, true)...)
+			}
+		}
+		return scripts
+	}
+	// compound adds the substitutions in the words of a compound command
+	// as a command of their own.
+	compound := func(words []*Word, redirs []*Redirect) {
+		if scripts := subst(words, redirs); len(scripts) > 0 {
+			cmds = append(cmds, command{subst: scripts, remote: remote})
+		}
+	}
+	var walk func(list *List) error
+	var node func(cmd CommandNode) error
+	walk = func(list *List) error {
+		if list == nil {
+			return nil
+		}
+		for _, ao := range list.Items {
+			for _, pl := range ao.Pipelines {
+				for _, cmd := range pl.Cmds {
+					if err := node(cmd); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	node = func(cmd CommandNode) error {
+		switch c := cmd.(type) {
+		case *SimpleCommand:
+			var args []arg
+			for _, w := range c.Args {
+				raw := script.slice(w.Span.Start, w.Span.End)
+				span := script.span(w.Span.Start, w.Span.End)
+				values, err := q.ExpandWord(w)
+				if err != nil {
+					return err
+				}
+				if v := unquotePOSIX(raw); len(values) == 1 && v.s == values[0] {
+					args = append(args, arg{v, span})
+					continue
+				}
+				for _, v := range values {
+					args = append(args, arg{coarse(v, span), span})
+				}
+			}
+			scripts := subst(append(append([]*Word(nil), c.Assigns...), c.Args...), c.Redirs)
+			if len(args) > 0 || len(scripts) > 0 {
+				cmds = append(cmds, command{args: args, subst: scripts, remote: remote})
+			}
+			return nil
+		case *Subshell:
+			compound(nil, c.Redirs)
+			return walk(c.Body)
+		case *BraceGroup:
+			compound(nil, c.Redirs)
+			return walk(c.Body)
+		case *IfClause:
+			compound(nil, c.Redirs)
+			for _, l := range []*List{c.Cond, c.Then, c.Else} {
+				if err := walk(l); err != nil {
+					return err
+				}
+			}
+			for _, e := range c.Elifs {
+				if err := walk(e.Cond); err != nil {
+					return err
+				}
+				if err := walk(e.Then); err != nil {
+					return err
+				}
+			}
+		case *CaseClause:
+			words := []*Word{c.Word}
+			for _, item := range c.Items {
+				words = append(words, item.Patterns...)
+			}
+			compound(words, c.Redirs)
+			for _, item := range c.Items {
+				if err := walk(item.Body); err != nil {
+					return err
+				}
+			}
+		case *ForClause:
+			compound(c.Items, c.Redirs)
+			return walk(c.Body)
+		case *WhileClause:
+			compound(nil, c.Redirs)
+			if err := walk(c.Cond); err != nil {
+				return err
+			}
+			return walk(c.Body)
+		case *FuncDecl:
+			return node(c.Body)
+		}
+		return nil
+	}
+	if err := walk(list); err != nil {
+		return nil, err
+	}
+	return cmds, nil
+}
+
+// splitter splits the scripts of cmd and PowerShell into commands and
+// words.
+type splitter struct {
+	script mapped
+	cmds   [][]arg
+	cmd    []arg
+	word   builder
+	start  int  // of the word
+	in     bool // a word is being read
+	redir  bool // the word is the target of a redirection
+}
+
+func (sp *splitter) add(i int) {
+	if !sp.in {
+		sp.in, sp.start = true, i
+	}
+	sp.word.add(sp.script.s[i], sp.script.at[i])
+}
+
+// quote starts a word at the quote or escape in i if there is none yet.
+func (sp *splitter) quote(i int) {
+	if !sp.in {
+		sp.in, sp.start = true, i
+	}
+}
+
+func (sp *splitter) endWord(i int) {
+	if !sp.in {
+		return
+	}
+	m := sp.word.done(sp.script.at[i])
+	if !sp.redir {
+		sp.cmd = append(sp.cmd, arg{m, sp.script.span(sp.start, i)})
+	}
+	sp.in, sp.redir = false, false
+}
+
+func (sp *splitter) endCmd(i int) {
+	sp.endWord(i)
+	if len(sp.cmd) > 0 {
+		sp.cmds = append(sp.cmds, sp.cmd)
+	}
+	sp.cmd = nil
+}
+
+// splitCmd splits a script of cmd.exe at &, &&, || and |. Its words are
+// split at spaces, with their double quotes and ^ escapes removed.
+func splitCmd(script mapped) [][]arg {
+	sp := &splitter{script: script}
+	s := script.s
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			sp.quote(i)
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				sp.add(i)
+			}
+		case '^':
+			if i+1 < len(s) {
+				sp.quote(i)
+				i++
+				sp.add(i)
+			}
+		case ' ', '\t', '\r', '\n':
+			sp.endWord(i)
+		case '&', '|':
+			sp.endCmd(i)
+			if i+1 < len(s) && s[i+1] == c {
+				i++
+			}
+		case '<', '>':
+			sp.endWord(i)
+			for i+1 < len(s) && (s[i+1] == '>' || s[i+1] == '&') {
+				i++
+			}
+			sp.redir = true
+		default:
+			sp.add(i)
+		}
+	}
+	sp.endCmd(len(s))
+	return sp.cmds
+}
+
+// splitPowerShell splits a PowerShell script at ;, |, &&, || and newlines.
+// Its words are split at spaces, with their quotes and ` escapes removed;
+// the call operator & is dropped.
+func splitPowerShell(script mapped) [][]arg {
+	sp := &splitter{script: script}
+	s := script.s
+	for i := 0; i < len(s); i++ {
+		if n := psQuote(s, i); n > 0 {
+			// A quote is written twice in '...'.
+			sp.quote(i)
+			for i += n; i < len(s); i++ {
+				if n = psQuote(s, i); n == 0 {
+					sp.add(i)
+					continue
+				}
+				m := psQuote(s, i+n)
+				if m == 0 {
+					i += n - 1
+					break
+				}
+				for j := i + n; j < i+n+m; j++ {
+					sp.add(j)
+				}
+				i += n + m - 1
+			}
+			continue
+		}
+		switch c := s[i]; c {
+		case '"':
+			sp.quote(i)
+			for i++; i < len(s); i++ {
+				if s[i] == '`' && i+1 < len(s) {
+					i++
+				} else if s[i] == '"' {
+					if i+1 < len(s) && s[i+1] == '"' {
+						i++
+					} else {
+						break
+					}
+				}
+				sp.add(i)
+			}
+		case '`':
+			if i+1 < len(s) {
+				sp.quote(i)
+				i++
+				if s[i] != '\n' {
+					sp.add(i)
+				}
+			}
+		case ' ', '\t', '\r':
+			sp.endWord(i)
+		case ';', '\n', '|':
+			sp.endCmd(i)
+			if i+1 < len(s) && c == '|' && s[i+1] == '|' {
+				i++
+			}
+		case '&':
+			if i+1 < len(s) && s[i+1] == '&' {
+				sp.endCmd(i)
+				i++
+			} else if sp.in {
+				sp.add(i)
+			} else if len(sp.cmd) > 0 {
+				sp.endCmd(i)
+			}
+		case '>', '<':
+			sp.endWord(i)
+			for i+1 < len(s) && (s[i+1] == '>' || s[i+1] == '&') {
+				i++
+			}
+			sp.redir = true
+		default:
+			sp.add(i)
+		}
+	}
+	sp.endCmd(len(s))
+	return sp.cmds
+}
+
+// psQuote returns the length of the single quote at s[i], or 0. PowerShell
+// takes the typographic ones for it too.
+func psQuote(s string, i int) int {
+	if i < len(s) && s[i] == '\'' {
+		return 1
+	}
+	if i+2 < len(s) && s[i] == 0xe2 && s[i+1] == 0x80 && 0x98 <= s[i+2] && s[i+2] <= 0x9b {
+		return 3
+	}
+	return 0
+}
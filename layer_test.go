@@ -0,0 +1,115 @@
+package shellwords
+
+import (
+	"os/exec"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestQuoteLayers(t *testing.T) {
+	args := []string{"printf", `%s|%s\n`, "it's \"quoted\"", `C:\dir\`, "a&b|c<d>e^f(g)!h", "", "‘smart’", "$HOME `x`"}
+	ssh := Layer{Shell: ShellSSH, Args: []string{"ssh", "host"}}
+	docker := Layer{Shell: ShellPOSIX, Args: []string{"docker", "exec", "c", "sh", "-c"}}
+	cmd := Layer{Shell: ShellCmd, Args: []string{"cmd", "/c"}}
+	ps := Layer{Shell: ShellPowerShell, Args: []string{"powershell", "-Command"}}
+	local := Layer{Shell: ShellPOSIX}
+
+	for _, layers := range [][]Layer{
+		{docker},
+		{ssh, docker},
+		{local, ssh, docker},
+		{cmd},
+		{ps},
+		{local, ssh, cmd},
+		{ssh, ps, cmd},
+		{cmd, ps},
+		{ps, ps},
+		{local, ssh, docker, ps, cmd},
+	} {
+		line, err := QuoteLayers(args, layers...)
+		if err != nil {
+			t.Fatalf("%v: %v", layers, err)
+		}
+		if err := VerifyLayers(line, args, layers...); err != nil {
+			t.Fatalf("%v: %q: %v", layers, line, err)
+		}
+	}
+}
+
+func TestQuoteLayersShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	args := []string{"printf", "[%s]", "it's", `"$HOME"`, `a\nb`, "`id`", ""}
+	sh := Layer{Shell: ShellPOSIX, Args: []string{"sh", "-c"}}
+	line, err := QuoteLayers(args, sh, sh, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("sh", "-c", line).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[it's][\"$HOME\"][a\\nb][`id`][]"; string(out) != want {
+		t.Fatalf("Expected %q, but %q", want, out)
+	}
+}
+
+func TestQuoteCmd(t *testing.T) {
+	line, err := QuoteLayers([]string{`C:\Program Files\app.exe`, `a "b" c\`, "100%"}, Layer{Shell: ShellCmd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `^"C:\Program Files\app.exe^" ^"a \^"b\^" c\\^" 100^%`; line != want {
+		t.Fatalf("Expected %q, but %q", want, line)
+	}
+	if args := splitWindowsArgs(`"C:\a b\x.exe" a\\\"b "c d" e""f "g""h" \\\\"i j"`); !reflect.DeepEqual(args, []string{`C:\a b\x.exe`, `a\"b`, "c d", "ef", `g"h`, `\\i j`}) {
+		t.Fatalf("Unexpected %q", args)
+	}
+	for _, args := range [][]string{{"a\nb"}, {`a"b`, "c"}, {"a", "b\r"}} {
+		if _, err := QuoteLayers(args, Layer{Shell: ShellCmd}); err == nil {
+			t.Fatalf("%q: Should be an error", args)
+		}
+	}
+}
+
+func TestVerifyLayersError(t *testing.T) {
+	args := []string{"echo", "a b"}
+	layers := []Layer{{Shell: ShellPOSIX}, {Shell: ShellPOSIX, Args: []string{"sh", "-c"}}}
+	for _, line := range []string{`sh -c echo a b`, `sh -c 'echo a b'`, `bash -c 'echo "a b"'`, `sh -c 'echo "a b"'; rm x`} {
+		if err := VerifyLayers(line, args, layers...); err == nil {
+			t.Fatalf("%q: Should be an error", line)
+		}
+	}
+	if err := VerifyLayers(`sh -c 'echo "a b"'`, args, layers...); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyLayers(`echo a & b`, []string{"echo", "a", "&", "b"}, Layer{Shell: ShellCmd}); err == nil {
+		t.Fatal("Should be an error")
+	}
+	// The shell would expand these, so the words it reads are not the ones
+	// written.
+	sh := Layer{Shell: ShellPOSIX}
+	for _, test := range []struct {
+		line string
+		args []string
+	}{
+		{`echo $(id)`, []string{"echo", "$(id)"}},
+		{"echo `id`", []string{"echo", "`id`"}},
+		{`echo "$(id)"`, []string{"echo", "$(id)"}},
+		{`echo $HOME`, []string{"echo", "$HOME"}},
+		{`rm *`, []string{"rm", "*"}},
+		{`rm a?`, []string{"rm", "a?"}},
+		{`rm [ab]`, []string{"rm", "[ab]"}},
+		{`cat ~/x`, []string{"cat", "~/x"}},
+		{`rm {a,b}`, []string{"rm", "{a,b}"}},
+	} {
+		if err := VerifyLayers(test.line, test.args, sh); err == nil {
+			t.Fatalf("%q: Should be an error", test.line)
+		}
+	}
+	if err := VerifyLayers(`echo '$(id) *' "~{a,b}" \$\*`, []string{"echo", "$(id) *", "~{a,b}", "$*"}, sh); err != nil {
+		t.Fatal(err)
+	}
+}
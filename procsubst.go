@@ -0,0 +1,41 @@
+package shellwords
+
+// ProcSubstExecutor runs the commands of process substitutions.
+type ProcSubstExecutor interface {
+	// Start starts command with its standard output connected to a pipe,
+	// or its standard input if write is true, and returns the path which
+	// the other end of the pipe can be opened at.
+	Start(command string, write bool) (string, error)
+}
+
+// parenEnd returns the offset just after the ')' which closes the '(' at
+// line[off], or -1 if there is none. Parentheses in quotes don't count.
+func parenEnd(line string, off int) int {
+	depth := 0
+	var quote byte
+	for i := off; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,76 @@
+package shellwords
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// PipeExecutor runs process substitutions with the shell, connected to the
+// command line through pipes. The paths it returns are /dev/fd/N, which
+// refer to the pipes in a command whose ExtraFiles are Files().
+type PipeExecutor struct {
+	// Dir is the working directory of the commands.
+	Dir string
+
+	files []*os.File
+	cmds  []*exec.Cmd
+}
+
+// Start implements ProcSubstExecutor.
+func (e *PipeExecutor) Start(command string, write bool) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	cmd := shellCommand(command, e.Dir)
+	cmd.Stderr = os.Stderr
+	ours, theirs := r, w
+	if write {
+		ours, theirs = w, r
+		cmd.Stdin = r
+	} else {
+		cmd.Stdout = w
+	}
+	err = cmd.Start()
+	theirs.Close()
+	if err != nil {
+		ours.Close()
+		return "", err
+	}
+	e.cmds = append(e.cmds, cmd)
+	e.files = append(e.files, ours)
+	return fmt.Sprintf("/dev/fd/%d", 2+len(e.files)), nil
+}
+
+// Files returns the ends of the pipes, to be used as the ExtraFiles of the
+// command which takes the paths as arguments.
+func (e *PipeExecutor) Files() []*os.File {
+	return e.files
+}
+
+// Wait closes the ends of the pipes held by e and waits for the commands
+// to exit. Call it once the command using the paths has been started.
+func (e *PipeExecutor) Wait() error {
+	for _, f := range e.files {
+		f.Close()
+	}
+	var first error
+	for _, cmd := range e.cmds {
+		if err := cmd.Wait(); err != nil && first == nil {
+			first = err
+		}
+	}
+	e.files, e.cmds = nil, nil
+	return first
+}
+
+// Close kills the commands and waits for them to exit. Parse calls it when
+// a process substitution fails, to stop those it started before.
+func (e *PipeExecutor) Close() error {
+	for _, cmd := range e.cmds {
+		cmd.Process.Kill()
+	}
+	e.Wait()
+	return nil
+}
@@ -0,0 +1,59 @@
+package shellwords
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestPipeExecutor(t *testing.T) {
+	var e PipeExecutor
+	parser := NewParser()
+	parser.ParseProcSubst = true
+	parser.ProcSubst = &e
+	args, err := parser.Parse(`cat <(printf 'b\na\n' | sort) <(echo c)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.ExtraFiles = e.Files()
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "a\nb\nc\n" {
+		t.Fatalf("Expected %q, but %q", "a\nb\nc\n", out)
+	}
+}
+
+type failingPipeExecutor struct {
+	PipeExecutor
+}
+
+func (e *failingPipeExecutor) Start(command string, write bool) (string, error) {
+	if command == "fail" {
+		return "", errors.New("cannot start")
+	}
+	return e.PipeExecutor.Start(command, write)
+}
+
+func TestPipeExecutorClose(t *testing.T) {
+	var e failingPipeExecutor
+	parser := NewParser()
+	parser.ParseProcSubst = true
+	parser.ProcSubst = &e
+	start := time.Now()
+	if _, err := parser.Parse(`cat <(sleep 60) <(fail)`); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if d := time.Since(start); d > 30*time.Second {
+		t.Fatalf("Took %v", d)
+	}
+	if len(e.Files()) != 0 {
+		t.Fatalf("Expected no files, but %d", len(e.Files()))
+	}
+}
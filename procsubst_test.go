@@ -0,0 +1,121 @@
+package shellwords
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProcSubstTokens(t *testing.T) {
+	parser := NewParser()
+	parser.ParseProcSubst = true
+	line := `diff <(sort a) <(sort "b)" | uniq) >(tee log) x<y`
+	tokens, err := parser.ParseTokens(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Token{
+		{Kind: TokenWord, Value: "diff", Span: Span{0, 4}},
+		{Kind: TokenProcSubstIn, Value: "sort a", Span: Span{5, 14}},
+		{Kind: TokenProcSubstIn, Value: `sort "b)" | uniq`, Span: Span{15, 34}},
+		{Kind: TokenProcSubstOut, Value: "tee log", Span: Span{35, 45}},
+		{Kind: TokenWord, Value: "x", Span: Span{46, 47}},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, tokens)
+	}
+	if parser.Position != 47 {
+		t.Fatalf("Expected position 47, but %d", parser.Position)
+	}
+
+	args, err := parser.Parse(`diff <(sort a) '<(b)'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"diff", "<(sort a)", "<(b)"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v:", want, args)
+	}
+
+	if _, err := parser.Parse(`diff <(sort a`); err == nil {
+		t.Fatal("Should be an error")
+	}
+}
+
+type fakeExecutor []string
+
+func (e *fakeExecutor) Start(command string, write bool) (string, error) {
+	*e = append(*e, command)
+	if write {
+		return "/out", nil
+	}
+	return "/in", nil
+}
+
+func TestProcSubstExecutor(t *testing.T) {
+	var e fakeExecutor
+	parser := NewParser()
+	parser.ParseProcSubst = true
+	parser.ProcSubst = &e
+	args, err := parser.Parse(`diff <(sort a) >(cat)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"diff", "/in", "/out"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v:", want, args)
+	}
+	if want := (fakeExecutor{"sort a", "cat"}); !reflect.DeepEqual(e, want) {
+		t.Fatalf("Expected %#v, but %#v:", want, e)
+	}
+}
+
+type failingExecutor struct {
+	fakeExecutor
+	closed bool
+}
+
+func (e *failingExecutor) Start(command string, write bool) (string, error) {
+	if command == "fail" {
+		return "", errors.New("cannot start")
+	}
+	return e.fakeExecutor.Start(command, write)
+}
+
+func (e *failingExecutor) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestProcSubstExecutorClose(t *testing.T) {
+	var e failingExecutor
+	parser := NewParser()
+	parser.ParseProcSubst = true
+	parser.ProcSubst = &e
+	if _, err := parser.Parse(`diff <(sort a) <(fail)`); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if !e.closed {
+		t.Fatal("Should be closed")
+	}
+}
+
+func TestProcSubstExecutorCloseWithAssignments(t *testing.T) {
+	var e failingExecutor
+	parser := NewParser()
+	parser.ParseProcSubst = true
+	parser.ProcSubst = &e
+	if _, _, err := parser.ParseWithAssignments(`A=1 diff <(sort a) <(fail)`); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if !e.closed {
+		t.Fatal("Should be closed")
+	}
+
+	e = failingExecutor{}
+	if _, err := parser.Command(context.Background(), `diff <(sort a) <missing/file`); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if !e.closed {
+		t.Fatal("Should be closed")
+	}
+}
@@ -0,0 +1,113 @@
+package shellwords
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// POSIXQuoter quotes words for a POSIX shell.
+type POSIXQuoter struct {
+	// If ANSIC is true, words containing non-printable characters are
+	// quoted as $'...' so that they stay readable. Parsing them back
+	// needs Parser.ParseANSIC.
+	ANSIC bool
+}
+
+// Quote returns s quoted so that a shell reads it back as a single word.
+func (q POSIXQuoter) Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if isSafe(s) {
+		return s
+	}
+	if q.ANSIC && !isPrintable(s) {
+		return quoteANSIC(s)
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Join quotes each of args and joins them with spaces.
+func (q POSIXQuoter) Join(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = q.Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Quote returns s quoted for a POSIX shell with the default POSIXQuoter.
+func Quote(s string) string {
+	return POSIXQuoter{}.Quote(s)
+}
+
+// Join quotes each of args for a POSIX shell and joins them with spaces.
+func Join(args []string) string {
+	return POSIXQuoter{}.Join(args)
+}
+
+func isSafe(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("_@%+=:,./-", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteANSIC(s string) string {
+	var b strings.Builder
+	b.WriteString("$'")
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && n == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\a':
+			b.WriteString(`\a`)
+		case r == '\b':
+			b.WriteString(`\b`)
+		case r == 0x1b:
+			b.WriteString(`\e`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\v':
+			b.WriteString(`\v`)
+		case r < 0x80 && !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r <= 0xffff && !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\U%08x`, r)
+		default:
+			b.WriteRune(r)
+		}
+		i += n
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in, posix, ansic string
+	}{
+		{"", "''", "''"},
+		{"foo", "foo", "foo"},
+		{"--bar=baz/qux.txt", "--bar=baz/qux.txt", "--bar=baz/qux.txt"},
+		{"foo bar", "'foo bar'", "'foo bar'"},
+		{"it's", `'it'\''s'`, `'it'\''s'`},
+		{"$HOME", "'$HOME'", "'$HOME'"},
+		{"a\tb\n", "'a\tb\n'", `$'a\tb\n'`},
+		{"it's\x01\xff", "'it'\\''s\x01\xff'", `$'it\'s\x01\xff'`},
+		{"☺\u200b", "'☺\u200b'", `$'☺\u200b'`},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.in); got != tt.posix {
+			t.Errorf("Quote(%q): expected %q, but %q", tt.in, tt.posix, got)
+		}
+		if got := (POSIXQuoter{ANSIC: true}).Quote(tt.in); got != tt.ansic {
+			t.Errorf("ANSIC Quote(%q): expected %q, but %q", tt.in, tt.ansic, got)
+		}
+	}
+}
+
+func TestJoinRoundTrip(t *testing.T) {
+	args := []string{"printf", "%s\n", "it's", "a \"b\" c", `\`, "", "tab\there", "\x1b[0m", "#", "~"}
+	for _, q := range []POSIXQuoter{{}, {ANSIC: true}} {
+		for _, mode := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+			parser := NewParser()
+			parser.ParseANSIC = true
+			parser.Escape = mode
+			got, err := parser.Parse(q.Join(args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, args) {
+				t.Fatalf("Expected %#v, but %#v:", args, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package shellwords
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// Resolver finds the executable which a command name runs, like
+// exec.LookPath, but with the environment, directory and file system it
+// is given rather than those of this process.
+type Resolver struct {
+	// Parser parses the lines given to ResolveLine. Its Env has PATH and
+	// PATHEXT, and its Dir is where relative names are. If nil,
+	// NewParser() is used.
+	Parser *Parser
+
+	// Dialect tells how paths, PATH and executables are handled. The
+	// zero value is DialectHost.
+	Dialect Dialect
+
+	// FS is the file system to look in, rooted at the root directory:
+	// /usr/bin/ls is usr/bin/ls in it, and C:\Windows is C:/Windows.
+	// Relative paths, as with an empty Dir, are never found in it. If nil,
+	// use the OS file system.
+	FS fs.FS
+}
+
+// Resolution is what Resolve found for a command name.
+type Resolution struct {
+	// Path is the executable, or "" if none was found.
+	Path string
+
+	// Tried are the candidates which were looked at, in order, Path last.
+	Tried []string
+}
+
+// Resolve returns the executable for the command name. Variables in
+// assigns, like those before the command, take the place of the ones in
+// Parser.Env. If none is found, the error is an *exec.Error for
+// exec.ErrNotFound, and the Resolution has the candidates tried.
+//
+// A name with a directory in it is only looked for there. On Windows the
+// current directory is looked in before PATH, and the extensions of
+// PATHEXT are tried if name has none of them.
+func (r *Resolver) Resolve(name string, assigns []Assignment) (*Resolution, error) {
+	p := r.parser()
+	env := p.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	d := r.dialect()
+	same := func(a, b string) bool {
+		return a == b || d == DialectWindows && strings.EqualFold(a, b)
+	}
+	getenv := func(key string) string {
+		for i := len(assigns) - 1; i >= 0; i-- {
+			if same(assigns[i].Name, key) {
+				return assigns[i].Value
+			}
+		}
+		for i := len(env) - 1; i >= 0; i-- {
+			if name := envName(env[i]); same(name, key) && len(name) < len(env[i]) {
+				return env[i][len(name)+1:]
+			}
+		}
+		return ""
+	}
+	var exts []string
+	if d == DialectWindows {
+		pathext := getenv("PATHEXT")
+		if pathext == "" {
+			pathext = ".COM;.EXE;.BAT;.CMD"
+		}
+		for _, ext := range strings.Split(strings.ToLower(pathext), ";") {
+			if ext != "" {
+				if ext[0] != '.' {
+					ext = "." + ext
+				}
+				exts = append(exts, ext)
+			}
+		}
+	}
+
+	res := &Resolution{}
+	if name == "" {
+		return res, &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	var files []string
+	if d.hasSep(name) {
+		files = []string{d.join(p.Dir, name)}
+	} else {
+		var dirs []string
+		if d == DialectWindows {
+			dirs = append(dirs, "")
+		}
+		if list := getenv("PATH"); list != "" {
+			dirs = append(dirs, strings.Split(list, d.listSep())...)
+		}
+		for _, dir := range dirs {
+			// An empty directory is the current one.
+			files = append(files, d.join(p.Dir, d.join(dir, name)))
+		}
+	}
+	for _, file := range files {
+		if r.find(res, file, exts) {
+			return res, nil
+		}
+	}
+	return res, &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// find looks for the executable file, or file with one of exts appended.
+func (r *Resolver) find(res *Resolution, file string, exts []string) bool {
+	if len(exts) > 0 {
+		for _, ext := range exts {
+			if strings.HasSuffix(strings.ToLower(file), ext) {
+				exts = append([]string{""}, exts...)
+				break
+			}
+		}
+	} else {
+		exts = []string{""}
+	}
+	for _, ext := range exts {
+		res.Tried = append(res.Tried, file+ext)
+		if r.executable(file + ext) {
+			res.Path = file + ext
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Resolver) executable(file string) bool {
+	var fi fs.FileInfo
+	var err error
+	if r.FS != nil {
+		if !r.dialect().isAbs(file) {
+			return false
+		}
+		name := file
+		if r.dialect() == DialectWindows {
+			name = strings.Replace(name, `\`, "/", -1)
+		}
+		name = path.Clean(name)
+		name = strings.TrimPrefix(name, "/")
+		if name == "" {
+			name = "."
+		}
+		if !fs.ValidPath(name) {
+			return false
+		}
+		fi, err = fs.Stat(r.FS, name)
+	} else {
+		fi, err = os.Stat(file)
+	}
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	return r.dialect() == DialectWindows || fi.Mode().Perm()&0111 != 0
+}
+
+func (r *Resolver) dialect() Dialect {
+	if r.Dialect == DialectHost {
+		return HostDialect
+	}
+	return r.Dialect
+}
+
+// ResolveLine parses line with ParseWithAssignments and resolves its
+// command, with the PATH of the assignments before it if there is one.
+func (r *Resolver) ResolveLine(line string) (*Resolution, error) {
+	assigns, args, err := r.parser().ParseWithAssignments(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errNoCommand
+	}
+	return r.Resolve(args[0], assigns)
+}
+
+func (r *Resolver) parser() *Parser {
+	if r.Parser == nil {
+		r.Parser = NewParser()
+	}
+	return r.Parser
+}
@@ -0,0 +1,112 @@
+package shellwords
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResolve(t *testing.T) {
+	fsys := fstest.MapFS{
+		"usr/bin/ls":        {Mode: 0755},
+		"usr/bin/data":      {Mode: 0644},
+		"usr/local/bin/ls":  {Mode: 0755},
+		"opt/bin/tool":      {Mode: 0755},
+		"home/me/deploy.sh": {Mode: 0755},
+		"home/me/bin":       {Mode: fs.ModeDir | 0755},
+	}
+	parser := NewParser()
+	parser.Dir = "/home/me"
+	parser.Env = []string{"PATH=/usr/local/bin:/usr/bin"}
+	r := &Resolver{Parser: parser, Dialect: DialectPOSIX, FS: fsys}
+
+	var tests = []struct {
+		line  string
+		path  string
+		tried []string
+	}{
+		{`ls -l`, "/usr/local/bin/ls", []string{"/usr/local/bin/ls"}},
+		{`PATH=/opt/bin:/usr/bin ls`, "/usr/bin/ls", []string{"/opt/bin/ls", "/usr/bin/ls"}},
+		{`PATH=/opt/bin tool`, "/opt/bin/tool", []string{"/opt/bin/tool"}},
+		{`./deploy.sh --prod`, "/home/me/./deploy.sh", []string{"/home/me/./deploy.sh"}},
+		{`/usr/bin/ls`, "/usr/bin/ls", []string{"/usr/bin/ls"}},
+		{`PATH=bin:/usr/bin ls`, "/usr/bin/ls", []string{"/home/me/bin/ls", "/usr/bin/ls"}},
+	}
+	for _, test := range tests {
+		res, err := r.ResolveLine(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if res.Path != test.path || !reflect.DeepEqual(res.Tried, test.tried) {
+			t.Fatalf("%q: Expected %q %q, but %q %q", test.line, test.path, test.tried, res.Path, res.Tried)
+		}
+	}
+
+	for _, line := range []string{`data`, `tool`, `bin`, `./missing`} {
+		res, err := r.ResolveLine(line)
+		if !errors.Is(err, exec.ErrNotFound) {
+			t.Fatalf("%q: Expected exec.ErrNotFound, but %v", line, err)
+		}
+		if res.Path != "" || len(res.Tried) == 0 {
+			t.Fatalf("%q: Expected candidates and no path, but %q %q", line, res.Path, res.Tried)
+		}
+	}
+
+	// Without Dir, relative names are not looked for at the root of FS.
+	fsys["deploy.sh"] = &fstest.MapFile{Mode: 0755}
+	parser.Dir = ""
+	if _, err := r.ResolveLine(`./deploy.sh`); !errors.Is(err, exec.ErrNotFound) {
+		t.Fatalf("Expected exec.ErrNotFound, but %v", err)
+	}
+}
+
+func TestResolveHostDialect(t *testing.T) {
+	if d := (&Resolver{}).dialect(); d != HostDialect {
+		t.Fatalf("Expected %v, but %v", HostDialect, d)
+	}
+	if d := (&Resolver{Dialect: DialectWindows}).dialect(); d != DialectWindows {
+		t.Fatalf("Expected %v, but %v", DialectWindows, d)
+	}
+}
+
+func TestResolveWindows(t *testing.T) {
+	fsys := fstest.MapFS{
+		"C:/Windows/System32/where.exe": {},
+		"C:/Tools/build.cmd":            {},
+		"C:/Tools/build.ps1":            {},
+		"C:/Work/run.bat":               {},
+	}
+	parser := NewParser()
+	parser.Dir = `C:\Work`
+	parser.Env = []string{`Path=C:\Windows\System32;C:\Tools`, "PATHEXT=.EXE;.CMD;.BAT"}
+	r := &Resolver{Parser: parser, Dialect: DialectWindows, FS: fsys}
+
+	var tests = []struct {
+		name  string
+		path  string
+		tried []string
+	}{
+		{"where", `C:\Windows\System32\where.exe`, []string{`C:\Work\where.exe`, `C:\Work\where.cmd`, `C:\Work\where.bat`, `C:\Windows\System32\where.exe`}},
+		{"run", `C:\Work\run.bat`, []string{`C:\Work\run.exe`, `C:\Work\run.cmd`, `C:\Work\run.bat`}},
+		{"build.cmd", `C:\Tools\build.cmd`, []string{`C:\Work\build.cmd`, `C:\Work\build.cmd.exe`, `C:\Work\build.cmd.cmd`, `C:\Work\build.cmd.bat`,
+			`C:\Windows\System32\build.cmd`, `C:\Windows\System32\build.cmd.exe`, `C:\Windows\System32\build.cmd.cmd`, `C:\Windows\System32\build.cmd.bat`,
+			`C:\Tools\build.cmd`}},
+		{`C:/Tools/build`, `C:/Tools/build.cmd`, []string{`C:/Tools/build.exe`, `C:/Tools/build.cmd`}},
+	}
+	for _, test := range tests {
+		res, err := r.Resolve(test.name, nil)
+		if err != nil {
+			t.Fatalf("%q: %v", test.name, err)
+		}
+		if res.Path != test.path || !reflect.DeepEqual(res.Tried, test.tried) {
+			t.Fatalf("%q: Expected %q %q, but %q %q", test.name, test.path, test.tried, res.Path, res.Tried)
+		}
+	}
+
+	if _, err := r.Resolve("build.ps1", nil); !errors.Is(err, exec.ErrNotFound) {
+		t.Fatalf("Expected exec.ErrNotFound, but %v", err)
+	}
+}
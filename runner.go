@@ -0,0 +1,376 @@
+package shellwords
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Runner runs the lists parsed by ParseScript with os/exec, without a
+// shell. It runs simple commands joined by pipes, &&, ||, ';' and '&',
+// with their redirections. Other constructs are an *UnsupportedError.
+//
+// Commands named in Builtins run in process. The ones which change Parser,
+// such as cd and export, are seen by the commands after them; in a
+// pipeline or in the background they change a copy of it instead, as in a
+// subshell, and the copy keeps the variables it sets rather than calling
+// Setenv.
+type Runner struct {
+	// Parser expands the words of the commands. If nil, NewParser() is
+	// used.
+	Parser *Parser
+
+	// The standard input, output and error of the commands. If nil, those
+	// of this process are used.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// If Pipefail is true, the status of a pipeline is the one of the last
+	// command which failed, as with set -o pipefail.
+	Pipefail bool
+
+	// Builtins are the commands run in process. If nil, DefaultBuiltins
+	// are used.
+	Builtins map[string]Builtin
+}
+
+// Register makes r run b for the command name. The first call copies
+// DefaultBuiltins into Builtins if it is nil.
+func (r *Runner) Register(name string, b Builtin) {
+	if r.Builtins == nil {
+		r.Builtins = map[string]Builtin{}
+		for k, v := range DefaultBuiltins {
+			r.Builtins[k] = v
+		}
+	}
+	r.Builtins[name] = b
+}
+
+// RunScript parses script and runs it. See Run.
+func (r *Runner) RunScript(ctx context.Context, script string) (int, error) {
+	list, err := r.parser().ParseScript(script)
+	if err != nil {
+		return 2, err
+	}
+	return r.Run(ctx, list)
+}
+
+// Run runs list and returns the exit status of the last pipeline. A command
+// which could not be started has the status 127, and one whose words or
+// redirections failed has 1; the reason is written to Stderr. The error is
+// for what stops running the list: an unsupported construct or the end of
+// ctx, which kills the commands which are running.
+func (r *Runner) Run(ctx context.Context, list *List) (int, error) {
+	if err := checkRunnable(list); err != nil {
+		return 2, err
+	}
+
+	rn := &run{r: r, p: r.parser(), stdin: r.Stdin, stdout: r.Stdout, stderr: r.Stderr}
+	if rn.stdin == nil {
+		rn.stdin = os.Stdin
+	}
+	if rn.stdout == nil {
+		rn.stdout = os.Stdout
+	}
+	if rn.stderr == nil {
+		rn.stderr = os.Stderr
+	}
+	// The commands read and write at the same time; lock readers and
+	// writers which are not files.
+	var mu sync.Mutex
+	if _, ok := rn.stdin.(*os.File); !ok {
+		rn.stdin = &lockedReader{r: rn.stdin}
+	}
+	rn.stdout = lockWriter(rn.stdout, &mu)
+	rn.stderr = lockWriter(rn.stderr, &mu)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, ao := range list.Items {
+		if ao.Background {
+			bg := *rn
+			bg.p = subshell(rn.p)
+			wg.Add(1)
+			go func(ao *AndOr) {
+				defer wg.Done()
+				bg.runAndOr(ctx, ao)
+			}(ao)
+			rn.status = 0
+		} else {
+			rn.status = rn.runAndOr(ctx, ao)
+		}
+		if err := ctx.Err(); err != nil {
+			return rn.status, err
+		}
+		if rn.exited {
+			break
+		}
+	}
+	return rn.status, nil
+}
+
+// checkRunnable returns an *UnsupportedError if list has something which
+// Run can not do.
+func checkRunnable(list *List) error {
+	for _, ao := range list.Items {
+		for _, pl := range ao.Pipelines {
+			for _, cmd := range pl.Cmds {
+				sc, ok := cmd.(*SimpleCommand)
+				if !ok {
+					return &UnsupportedError{Construct: construct(cmd), Span: cmd.Pos()}
+				}
+				if len(sc.Args) == 0 {
+					return &UnsupportedError{Construct: "assignment", Span: sc.Span}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// run is the state of a Runner while it runs a list.
+type run struct {
+	r      *Runner
+	p      *Parser
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	status int  // of the last pipeline
+	exited bool // by the exit builtin
+}
+
+func (rn *run) runAndOr(ctx context.Context, ao *AndOr) int {
+	status := rn.runPipeline(ctx, ao.Pipelines[0])
+	for i, pl := range ao.Pipelines[1:] {
+		if rn.exited {
+			break
+		}
+		if (ao.Ops[i] == "&&") == (status == 0) {
+			rn.status = status
+			status = rn.runPipeline(ctx, pl)
+		}
+	}
+	return status
+}
+
+func (rn *run) runPipeline(ctx context.Context, pl *Pipeline) int {
+	if ctx.Err() != nil {
+		return 1
+	}
+
+	n := len(pl.Cmds)
+	cmds := make([]*exec.Cmd, n)
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	var stdin interface{} = rn.stdin
+	for i, c := range pl.Cmds {
+		// Our ends of the pipes and the files opened for redirections are
+		// closed once the command has them.
+		var files []*os.File
+		if f, ok := stdin.(*os.File); ok && i > 0 {
+			files = append(files, f)
+		}
+		fds := map[int]interface{}{0: stdin, 1: rn.stdout, 2: rn.stderr}
+		if i < n-1 {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				fmt.Fprintln(rn.stderr, err)
+				statuses[i] = 1
+				closeFiles(files)
+				break
+			}
+			files = append(files, pw)
+			fds[1], stdin = pw, pr
+		}
+
+		assigns, args, opened, err := rn.p.expandCommand(c.(*SimpleCommand), fds)
+		files = append(files, opened...)
+		if err != nil {
+			fmt.Fprintln(rn.stderr, err)
+			statuses[i] = 1
+			closeFiles(files)
+			continue
+		}
+
+		if b, ok := rn.builtin(args[0]); ok {
+			bc := &BuiltinContext{
+				Args:   args,
+				Stdin:  fdReader(fds[0]),
+				Stdout: fdWriter(fds[1]),
+				Stderr: fdWriter(fds[2]),
+				Parser: rn.p,
+				Status: rn.status,
+				run:    rn,
+			}
+			if n == 1 {
+				statuses[i] = b(ctx, bc)
+				closeFiles(files)
+				continue
+			}
+			bc.Parser, bc.run = subshell(rn.p), nil
+			wg.Add(1)
+			go func(i int, files []*os.File) {
+				defer wg.Done()
+				defer closeFiles(files)
+				statuses[i] = b(ctx, bc)
+			}(i, files)
+			continue
+		}
+
+		var notFound *exec.Error
+		cmd, err := rn.p.command(ctx, assigns, args, fds)
+		switch {
+		case errors.As(err, &notFound):
+			statuses[i] = 127
+		case err != nil:
+			statuses[i] = 1
+		default:
+			if err = cmd.Start(); err != nil {
+				statuses[i] = 127
+			}
+		}
+		closeFiles(files)
+		if err != nil {
+			fmt.Fprintln(rn.stderr, err)
+			continue
+		}
+		cmds[i] = cmd
+	}
+
+	for i, cmd := range cmds {
+		if cmd != nil {
+			statuses[i] = exitStatus(cmd.Wait())
+		}
+	}
+	wg.Wait()
+	status := statuses[n-1]
+	if rn.r.Pipefail {
+		for _, s := range statuses {
+			if s != 0 {
+				status = s
+			}
+		}
+	}
+	if pl.Bang {
+		if status == 0 {
+			status = 1
+		} else {
+			status = 0
+		}
+	}
+	return status
+}
+
+func (rn *run) builtin(name string) (Builtin, bool) {
+	builtins := rn.r.Builtins
+	if builtins == nil {
+		builtins = DefaultBuiltins
+	}
+	b, ok := builtins[name]
+	return b, ok
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// fdReader returns the reader for the standard input f of a builtin.
+func fdReader(f interface{}) io.Reader {
+	if r, ok := f.(io.Reader); ok {
+		return r
+	}
+	return strings.NewReader("")
+}
+
+// fdWriter returns the writer for the output f of a builtin.
+func fdWriter(f interface{}) io.Writer {
+	if w, ok := f.(io.Writer); ok {
+		return w
+	}
+	return io.Discard
+}
+
+// exitStatus returns the exit status for the error of Wait.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e *exec.ExitError
+	if errors.As(err, &e) && e.ExitCode() > 0 {
+		return e.ExitCode()
+	}
+	return 1
+}
+
+func (r *Runner) parser() *Parser {
+	if r.Parser == nil {
+		r.Parser = NewParser()
+	}
+	return r.Parser
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(b)
+}
+
+func lockWriter(w io.Writer, mu *sync.Mutex) io.Writer {
+	if _, ok := w.(*os.File); ok {
+		return w
+	}
+	return &lockedWriter{mu: mu, w: w}
+}
+
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (r *lockedReader) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Read(b)
+}
+
+// subshell returns a copy of p for a pipeline or the background. Its
+// variables are its own: with Getenv set, what it sets is kept in the copy
+// instead of going to Setenv.
+func subshell(p *Parser) *Parser {
+	q := *p
+	if p.Getenv != nil {
+		var mu sync.Mutex
+		vars := map[string]string{}
+		getenv := p.Getenv
+		q.Getenv = func(name string) string {
+			mu.Lock()
+			value, ok := vars[name]
+			mu.Unlock()
+			if ok {
+				return value
+			}
+			return getenv(name)
+		}
+		q.Setenv = func(name, value string) error {
+			mu.Lock()
+			vars[name] = value
+			mu.Unlock()
+			return nil
+		}
+	}
+	return &q
+}
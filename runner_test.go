@@ -0,0 +1,100 @@
+package shellwords
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs POSIX commands")
+	}
+	dir := t.TempDir()
+	var tests = []struct {
+		script string
+		status int
+		out    string
+	}{
+		{`echo hello`, 0, "hello\n"},
+		{`printf 'b\na\nb\n' | sort | uniq -c | tr -s ' '`, 0, " 1 a\n 2 b\n"},
+		{`true && echo yes || echo no`, 0, "yes\n"},
+		{`false && echo yes || echo no`, 0, "no\n"},
+		{`false; echo next`, 0, "next\n"},
+		{`echo a | false`, 1, ""},
+		{`false | true`, 0, ""},
+		{`! false`, 0, ""},
+		{`echo one >out.txt; echo two >>out.txt; cat <out.txt`, 0, "one\ntwo\n"},
+		{`cat <<EOF | tr a-z A-Z
+hello $X
+EOF`, 0, "HELLO $X\n"},
+		{`X=1 sh -c 'echo $X' 2>&1`, 0, "1\n"},
+		{`sh -c 'echo err >&2' 2>&1 | cat`, 0, "err\n"},
+		{`sh -c 'exit 3'`, 3, ""},
+		{`no-such-command-here`, 127, ""},
+		{`cat <no-such-file`, 1, ""},
+		{`sleep 0.1 & echo first; wait-not-needed 2>/dev/null`, 127, "first\n"},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		parser := NewParser()
+		parser.Dir = dir
+		r := &Runner{Parser: parser, Stdin: strings.NewReader(""), Stdout: &stdout, Stderr: &stderr}
+		status, err := r.RunScript(context.Background(), test.script)
+		if err != nil {
+			t.Fatalf("%q: %v", test.script, err)
+		}
+		if status != test.status || stdout.String() != test.out {
+			t.Fatalf("%q: Expected %d %q, but %d %q (%s)", test.script, test.status, test.out, status, stdout.String(), stderr.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunnerPipefail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs POSIX commands")
+	}
+	r := &Runner{Pipefail: true, Stdout: &bytes.Buffer{}}
+	status, err := r.RunScript(context.Background(), `sh -c 'exit 2' | sh -c 'exit 3' | true`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 3 {
+		t.Fatalf("Expected 3, but %d", status)
+	}
+}
+
+func TestRunnerCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs POSIX commands")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	r := &Runner{}
+	_, err := r.RunScript(ctx, `sleep 10 | sleep 10; sleep 10`)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v, but %v", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Took %v", d)
+	}
+}
+
+func TestRunnerUnsupported(t *testing.T) {
+	r := &Runner{}
+	for _, script := range []string{`(a)`, `a | { b; }`, `FOO=1`, `if a; then b; fi`} {
+		_, err := r.RunScript(context.Background(), script)
+		if _, ok := err.(*UnsupportedError); !ok {
+			t.Fatalf("%q: Expected *UnsupportedError, but %v", script, err)
+		}
+	}
+}
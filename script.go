@@ -0,0 +1,952 @@
+package shellwords
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError is an error in the syntax of a script.
+type SyntaxError struct {
+	Span Span
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d: %s", e.Span.Start, e.Msg)
+}
+
+type scriptTokenKind int
+
+const (
+	tEOF scriptTokenKind = iota
+	tWord
+	tOp
+	tIONumber
+)
+
+type scriptToken struct {
+	kind scriptTokenKind
+	val  string
+	span Span
+
+	// alias is true for the tokens of an alias expansion.
+	alias bool
+}
+
+func (t scriptToken) isWord(val string) bool {
+	return t.kind == tWord && t.val == val
+}
+
+func (t scriptToken) isOp(val string) bool {
+	return t.kind == tOp && t.val == val
+}
+
+func (t scriptToken) String() string {
+	switch {
+	case t.kind == tEOF:
+		return "end of script"
+	case t.val == "\n":
+		return "newline"
+	}
+	return strconv.Quote(t.val)
+}
+
+// Operators, the longer ones first.
+var scriptOps = []string{
+	"<<-", "<<<", "&>>",
+	"&&", "||", ";;", "<<", ">>", "<&", ">&", "<>", ">|", "&>",
+	"&", "|", ";", "<", ">", "(", ")",
+}
+
+var redirectOps = map[string]bool{
+	"<": true, ">": true, ">>": true, "<>": true, ">|": true, "<&": true, ">&": true,
+	"<<": true, "<<-": true, "<<<": true, "&>": true, "&>>": true,
+}
+
+func isOpChar(c byte) bool {
+	return strings.IndexByte("|&;<>()", c) >= 0
+}
+
+// scriptLexer splits a script into words and operators.
+type scriptLexer struct {
+	p        *Parser
+	src      string
+	off      int
+	heredocs []*Redirect
+
+	// Tokens of an alias expansion which are yet to be read, and whether
+	// the word after them is to be checked for an alias too.
+	queue []scriptToken
+	chain bool
+}
+
+func (lx *scriptLexer) errorf(start, end int, format string, args ...interface{}) error {
+	return &SyntaxError{Span: Span{Start: start, End: end}, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (lx *scriptLexer) next() (scriptToken, error) {
+	if len(lx.queue) > 0 {
+		t := lx.queue[0]
+		lx.queue = lx.queue[1:]
+		return t, nil
+	}
+	t, err := lx.scan()
+	if err == nil && lx.chain {
+		lx.chain = false
+		return lx.alias(t)
+	}
+	return t, err
+}
+
+func (lx *scriptLexer) scan() (scriptToken, error) {
+	src := lx.src
+	for lx.off < len(src) {
+		c := src[lx.off]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			lx.off++
+			continue
+		case c == '\\' && lx.off+1 < len(src) && src[lx.off+1] == '\n':
+			lx.off += 2
+			continue
+		case c == '#':
+			for lx.off < len(src) && src[lx.off] != '\n' {
+				lx.off++
+			}
+			continue
+		}
+		break
+	}
+
+	start := lx.off
+	if start == len(src) {
+		if len(lx.heredocs) > 0 {
+			r := lx.heredocs[0]
+			return scriptToken{}, lx.errorf(r.Span.Start, start, "here-document is not closed by %q", r.Target.Raw)
+		}
+		return scriptToken{kind: tEOF, span: Span{Start: start, End: start}}, nil
+	}
+
+	c := src[start]
+	if c == '\n' {
+		lx.off++
+		if err := lx.readHeredocs(); err != nil {
+			return scriptToken{}, err
+		}
+		return scriptToken{kind: tOp, val: "\n", span: Span{Start: start, End: start + 1}}, nil
+	}
+
+	if isOpChar(c) && !(lx.p.ParseProcSubst && (c == '<' || c == '>') && strings.HasPrefix(src[start+1:], "(")) {
+		for _, op := range scriptOps {
+			if strings.HasPrefix(src[start:], op) {
+				lx.off += len(op)
+				return scriptToken{kind: tOp, val: op, span: Span{Start: start, End: lx.off}}, nil
+			}
+		}
+	}
+
+	end, err := lx.scanWord(start)
+	if err != nil {
+		return scriptToken{}, err
+	}
+	lx.off = end
+	kind := tWord
+	if isDigits(src[start:end]) && end < len(src) && (src[end] == '<' || src[end] == '>') {
+		kind = tIONumber
+	}
+	return scriptToken{kind: kind, val: src[start:end], span: Span{Start: start, End: end}}, nil
+}
+
+// scanWord returns the end of the word starting at off.
+func (lx *scriptLexer) scanWord(off int) (int, error) {
+	src := lx.src
+	extGlob := lx.p.ParseGlob && lx.p.Glob&GlobExt != 0
+	i := off
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case isSpace(rune(c)):
+			return i, nil
+		case (c == '<' || c == '>') && i == off && lx.p.ParseProcSubst && strings.HasPrefix(src[i+1:], "("):
+			end := parenEnd(src, i+1)
+			if end < 0 {
+				return 0, lx.errorf(i, len(src), "unterminated process substitution")
+			}
+			i = end
+		case c == '(' && extGlob && i > off && strings.IndexByte("?*+@!", src[i-1]) >= 0:
+			end := parenEnd(src, i)
+			if end < 0 {
+				return 0, lx.errorf(i, len(src), "unterminated pattern")
+			}
+			i = end
+		case isOpChar(c):
+			return i, nil
+		case c == '\\':
+			i += 2
+		case c == '\'':
+			end := strings.IndexByte(src[i+1:], '\'')
+			if end < 0 {
+				return 0, lx.errorf(i, len(src), "unterminated quoted string")
+			}
+			i += end + 2
+		case c == '"':
+			end, err := lx.scanDoubleQuote(i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		case c == '`':
+			end, err := lx.scanBackquote(i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		case c == '$':
+			end, err := lx.scanDollar(i, false)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	if i > len(src) {
+		i = len(src)
+	}
+	return i, nil
+}
+
+func (lx *scriptLexer) scanDoubleQuote(off int) (int, error) {
+	src := lx.src
+	for i := off + 1; i < len(src); {
+		switch src[i] {
+		case '"':
+			return i + 1, nil
+		case '\\':
+			i += 2
+		case '`':
+			end, err := lx.scanBackquote(i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		case '$':
+			end, err := lx.scanDollar(i, true)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	return 0, lx.errorf(off, len(src), "unterminated quoted string")
+}
+
+func (lx *scriptLexer) scanBackquote(off int) (int, error) {
+	src := lx.src
+	for i := off + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '`':
+			return i + 1, nil
+		}
+	}
+	return 0, lx.errorf(off, len(src), "unterminated backquote")
+}
+
+// scanDollar returns the end of what starts with the '$' at off, in double
+// quotes if quoted.
+func (lx *scriptLexer) scanDollar(off int, quoted bool) (int, error) {
+	src := lx.src
+	if off+1 == len(src) {
+		return off + 1, nil
+	}
+	switch src[off+1] {
+	case '\'':
+		for i := off + 2; i < len(src); i++ {
+			switch src[i] {
+			case '\\':
+				i++
+			case '\'':
+				return i + 1, nil
+			}
+		}
+		return 0, lx.errorf(off, len(src), "unterminated $'...' string")
+	case '(':
+		end := parenEnd(src, off+1)
+		if end < 0 {
+			return 0, lx.errorf(off, len(src), "unterminated command substitution")
+		}
+		return end, nil
+	case '{':
+		// Quotes in it hide a }, as in ${x:-'}'}, but a ' is as it is in
+		// double quotes.
+		for i := off + 2; i < len(src); {
+			switch src[i] {
+			case '}':
+				return i + 1, nil
+			case '\\':
+				i += 2
+			case '\'':
+				if quoted {
+					i++
+					break
+				}
+				end := strings.IndexByte(src[i+1:], '\'')
+				if end < 0 {
+					return 0, lx.errorf(i, len(src), "unterminated quoted string")
+				}
+				i += end + 2
+			case '"':
+				end, err := lx.scanDoubleQuote(i)
+				if err != nil {
+					return 0, err
+				}
+				i = end
+			case '$':
+				end, err := lx.scanDollar(i, quoted)
+				if err != nil {
+					return 0, err
+				}
+				i = end
+			default:
+				i++
+			}
+		}
+		return 0, lx.errorf(off, len(src), "unterminated parameter expansion")
+	}
+	return off + 1, nil
+}
+
+// readHeredocs reads the bodies of the here-documents which were started
+// on the line which just ended.
+func (lx *scriptLexer) readHeredocs() error {
+	for _, r := range lx.heredocs {
+		delim := r.Target.Raw
+		if strings.ContainsAny(delim, `'"\`) {
+			r.HeredocQuoted = true
+			delim = strings.NewReplacer(`'`, "", `"`, "", `\`, "").Replace(delim)
+		}
+		var body strings.Builder
+		closed := false
+		for lx.off < len(lx.src) {
+			end := strings.IndexByte(lx.src[lx.off:], '\n')
+			line := lx.src[lx.off:]
+			if end >= 0 {
+				line = lx.src[lx.off : lx.off+end+1]
+			}
+			lx.off += len(line)
+			if r.Op == "<<-" {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if strings.TrimSuffix(line, "\n") == delim {
+				closed = true
+				break
+			}
+			body.WriteString(line)
+		}
+		if !closed {
+			return lx.errorf(r.Span.Start, len(lx.src), "here-document is not closed by %q", delim)
+		}
+		r.Heredoc = body.String()
+		r.Span.End = lx.off
+	}
+	lx.heredocs = nil
+	return nil
+}
+
+// scriptParser builds the syntax tree of a script from its tokens.
+type scriptParser struct {
+	p   *Parser
+	lx  *scriptLexer
+	tok scriptToken
+	has bool
+}
+
+func (sp *scriptParser) peek() (scriptToken, error) {
+	if !sp.has {
+		tok, err := sp.lx.next()
+		if err != nil {
+			return scriptToken{}, err
+		}
+		sp.tok, sp.has = tok, true
+	}
+	return sp.tok, nil
+}
+
+func (sp *scriptParser) next() (scriptToken, error) {
+	tok, err := sp.peek()
+	sp.has = false
+	return tok, err
+}
+
+// alias replaces the next token by its alias if it has one.
+func (sp *scriptParser) alias() (scriptToken, error) {
+	t, err := sp.peek()
+	if err != nil {
+		return scriptToken{}, err
+	}
+	if t, err = sp.lx.alias(t); err != nil {
+		return scriptToken{}, err
+	}
+	sp.tok = t
+	return t, nil
+}
+
+func (sp *scriptParser) unexpected(t scriptToken) error {
+	return &SyntaxError{Span: t.span, Msg: "unexpected " + t.String()}
+}
+
+// linebreak skips newlines.
+func (sp *scriptParser) linebreak() error {
+	for {
+		t, err := sp.peek()
+		if err != nil {
+			return err
+		}
+		if t.kind != tOp || t.val != "\n" {
+			return nil
+		}
+		sp.has = false
+	}
+}
+
+// isStop reports whether t ends the list being parsed: the end of the
+// script, or a word or operator in stops. It is only called where a
+// command would start or just after one, and a simple command takes the
+// words after it, so a word here is in a place for a reserved word.
+func isStop(t scriptToken, stops []string) bool {
+	if t.kind == tEOF {
+		return true
+	}
+	if t.kind != tWord && t.kind != tOp {
+		return false
+	}
+	for _, stop := range stops {
+		if t.val == stop {
+			return true
+		}
+	}
+	return false
+}
+
+func (sp *scriptParser) parseList(stops ...string) (*List, error) {
+	list := &List{}
+	if err := sp.linebreak(); err != nil {
+		return nil, err
+	}
+	for {
+		t, err := sp.peek()
+		if err != nil {
+			return nil, err
+		}
+		if isStop(t, stops) {
+			break
+		}
+		ao, err := sp.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, ao)
+
+		if t, err = sp.peek(); err != nil {
+			return nil, err
+		}
+		if t.kind == tOp && (t.val == ";" || t.val == "&" || t.val == "\n") {
+			sp.has = false
+			ao.Background = t.val == "&"
+			if err := sp.linebreak(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !isStop(t, stops) {
+			return nil, sp.unexpected(t)
+		}
+		break
+	}
+	if len(list.Items) > 0 {
+		list.Span = Span{Start: list.Items[0].Span.Start, End: list.Items[len(list.Items)-1].Span.End}
+	}
+	return list, nil
+}
+
+func (sp *scriptParser) parseAndOr() (*AndOr, error) {
+	pl, err := sp.parsePipeline()
+	if err != nil {
+		return nil, err
+	}
+	ao := &AndOr{Pipelines: []*Pipeline{pl}, Span: pl.Span}
+	for {
+		t, err := sp.peek()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind != tOp || t.val != "&&" && t.val != "||" {
+			return ao, nil
+		}
+		sp.has = false
+		if err := sp.linebreak(); err != nil {
+			return nil, err
+		}
+		if pl, err = sp.parsePipeline(); err != nil {
+			return nil, err
+		}
+		ao.Ops = append(ao.Ops, t.val)
+		ao.Pipelines = append(ao.Pipelines, pl)
+		ao.Span.End = pl.Span.End
+	}
+}
+
+func (sp *scriptParser) parsePipeline() (*Pipeline, error) {
+	pl := &Pipeline{}
+	t, err := sp.peek()
+	if err != nil {
+		return nil, err
+	}
+	pl.Span.Start = t.span.Start
+	if t.kind == tWord && t.val == "!" {
+		sp.has = false
+		pl.Bang = true
+	}
+	for {
+		cmd, err := sp.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pl.Cmds = append(pl.Cmds, cmd)
+		pl.Span.End = cmd.Pos().End
+		if t, err = sp.peek(); err != nil {
+			return nil, err
+		}
+		if t.kind != tOp || t.val != "|" {
+			return pl, nil
+		}
+		sp.has = false
+		if err := sp.linebreak(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// closers are the reserved words which end a compound command. They can
+// not start a command.
+var closers = map[string]bool{
+	"then": true, "elif": true, "else": true, "fi": true,
+	"do": true, "done": true, "esac": true, "}": true,
+}
+
+func (sp *scriptParser) parseCommand() (CommandNode, error) {
+	t, err := sp.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == tWord && !reservedWords[t.val] {
+		if t, err = sp.alias(); err != nil {
+			return nil, err
+		}
+	}
+	if t.kind == tWord && closers[t.val] {
+		return nil, sp.unexpected(t)
+	}
+	switch {
+	case t.isOp("("):
+		sp.has = false
+		body, end, err := sp.parseBody(t, ")")
+		if err != nil {
+			return nil, err
+		}
+		cmd := &Subshell{Body: body, Span: Span{Start: t.span.Start, End: end.span.End}}
+		cmd.Redirs, err = sp.parseRedirects(&cmd.Span)
+		return cmd, err
+	case t.isWord("{"):
+		sp.has = false
+		body, end, err := sp.parseBody(t, "}")
+		if err != nil {
+			return nil, err
+		}
+		cmd := &BraceGroup{Body: body, Span: Span{Start: t.span.Start, End: end.span.End}}
+		cmd.Redirs, err = sp.parseRedirects(&cmd.Span)
+		return cmd, err
+	case t.isWord("if"):
+		sp.has = false
+		return sp.parseIf(t)
+	case t.isWord("case"):
+		sp.has = false
+		return sp.parseCase(t)
+	case t.isWord("for"):
+		sp.has = false
+		return sp.parseFor(t)
+	case t.isWord("while"), t.isWord("until"):
+		sp.has = false
+		return sp.parseWhile(t)
+	}
+	return sp.parseSimpleCommand()
+}
+
+// parseBody parses the list of a compound command which was opened by open,
+// up to one of stops. It returns the list and the stop which was found.
+func (sp *scriptParser) parseBody(open scriptToken, stops ...string) (*List, scriptToken, error) {
+	body, err := sp.parseList(stops...)
+	if err != nil {
+		return nil, scriptToken{}, err
+	}
+	t, err := sp.peek()
+	if err != nil {
+		return nil, scriptToken{}, err
+	}
+	if t.kind == tEOF || !isStop(t, stops) {
+		return nil, scriptToken{}, sp.unclosed(open, t, stops[len(stops)-1])
+	}
+	if len(body.Items) == 0 {
+		return nil, scriptToken{}, sp.unexpected(t)
+	}
+	sp.has = false
+	return body, t, nil
+}
+
+func (sp *scriptParser) unclosed(open, t scriptToken, close string) error {
+	return &SyntaxError{Span: Span{Start: open.span.Start, End: t.span.End}, Msg: fmt.Sprintf("%q is not closed by %q", open.val, close)}
+}
+
+func (sp *scriptParser) parseIf(open scriptToken) (CommandNode, error) {
+	cmd := &IfClause{Span: open.span}
+	var t scriptToken
+	var err error
+	if cmd.Cond, _, err = sp.parseBody(open, "then"); err != nil {
+		return nil, err
+	}
+	if cmd.Then, t, err = sp.parseBody(open, "elif", "else", "fi"); err != nil {
+		return nil, err
+	}
+	for t.val == "elif" {
+		elif := &Elif{Span: t.span}
+		if elif.Cond, _, err = sp.parseBody(open, "then"); err != nil {
+			return nil, err
+		}
+		if elif.Then, t, err = sp.parseBody(open, "elif", "else", "fi"); err != nil {
+			return nil, err
+		}
+		elif.Span.End = elif.Then.Span.End
+		cmd.Elifs = append(cmd.Elifs, elif)
+	}
+	if t.val == "else" {
+		if cmd.Else, t, err = sp.parseBody(open, "fi"); err != nil {
+			return nil, err
+		}
+	}
+	cmd.Span.End = t.span.End
+	cmd.Redirs, err = sp.parseRedirects(&cmd.Span)
+	return cmd, err
+}
+
+func (sp *scriptParser) parseCase(open scriptToken) (CommandNode, error) {
+	t, err := sp.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != tWord {
+		return nil, sp.unexpected(t)
+	}
+	cmd := &CaseClause{Word: &Word{Raw: t.val, Span: t.span}, Span: open.span}
+	if err := sp.linebreak(); err != nil {
+		return nil, err
+	}
+	if t, err = sp.next(); err != nil {
+		return nil, err
+	}
+	if !t.isWord("in") {
+		return nil, sp.unexpected(t)
+	}
+	for {
+		if err := sp.linebreak(); err != nil {
+			return nil, err
+		}
+		if t, err = sp.next(); err != nil {
+			return nil, err
+		}
+		if t.isWord("esac") {
+			break
+		}
+		item := &CaseItem{Span: t.span}
+		if t.isOp("(") {
+			if t, err = sp.next(); err != nil {
+				return nil, err
+			}
+		}
+		for {
+			if t.kind != tWord {
+				if t.kind == tEOF {
+					return nil, sp.unclosed(open, t, "esac")
+				}
+				return nil, sp.unexpected(t)
+			}
+			item.Patterns = append(item.Patterns, &Word{Raw: t.val, Span: t.span})
+			if t, err = sp.next(); err != nil {
+				return nil, err
+			}
+			if t.isOp(")") {
+				break
+			}
+			if !t.isOp("|") {
+				return nil, sp.unexpected(t)
+			}
+			if t, err = sp.next(); err != nil {
+				return nil, err
+			}
+		}
+		item.Span.End = t.span.End
+		if item.Body, err = sp.parseList(";;", "esac"); err != nil {
+			return nil, err
+		}
+		if len(item.Body.Items) > 0 {
+			item.Span.End = item.Body.Span.End
+		}
+		cmd.Items = append(cmd.Items, item)
+		if t, err = sp.peek(); err != nil {
+			return nil, err
+		}
+		if t.isOp(";;") {
+			sp.has = false
+			item.Span.End = t.span.End
+		} else if !t.isWord("esac") {
+			return nil, sp.unclosed(open, t, "esac")
+		}
+	}
+	cmd.Span.End = t.span.End
+	cmd.Redirs, err = sp.parseRedirects(&cmd.Span)
+	return cmd, err
+}
+
+func (sp *scriptParser) parseFor(open scriptToken) (CommandNode, error) {
+	t, err := sp.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != tWord || !isName(t.val) {
+		return nil, &SyntaxError{Span: t.span, Msg: "bad for loop variable " + t.String()}
+	}
+	cmd := &ForClause{Name: &Word{Raw: t.val, Span: t.span}, Span: open.span}
+	if err := sp.linebreak(); err != nil {
+		return nil, err
+	}
+	if t, err = sp.peek(); err != nil {
+		return nil, err
+	}
+	switch {
+	case t.isWord("in"):
+		sp.has = false
+		cmd.In = true
+		for {
+			if t, err = sp.next(); err != nil {
+				return nil, err
+			}
+			if t.kind != tWord {
+				break
+			}
+			cmd.Items = append(cmd.Items, &Word{Raw: t.val, Span: t.span})
+		}
+		if !t.isOp(";") && !t.isOp("\n") {
+			return nil, sp.unexpected(t)
+		}
+	case t.isOp(";"):
+		sp.has = false
+	}
+	if err := sp.linebreak(); err != nil {
+		return nil, err
+	}
+	if t, err = sp.next(); err != nil {
+		return nil, err
+	}
+	if !t.isWord("do") {
+		return nil, sp.unexpected(t)
+	}
+	if cmd.Body, t, err = sp.parseBody(open, "done"); err != nil {
+		return nil, err
+	}
+	cmd.Span.End = t.span.End
+	cmd.Redirs, err = sp.parseRedirects(&cmd.Span)
+	return cmd, err
+}
+
+func (sp *scriptParser) parseWhile(open scriptToken) (CommandNode, error) {
+	cmd := &WhileClause{Until: open.val == "until", Span: open.span}
+	var t scriptToken
+	var err error
+	if cmd.Cond, _, err = sp.parseBody(open, "do"); err != nil {
+		return nil, err
+	}
+	if cmd.Body, t, err = sp.parseBody(open, "done"); err != nil {
+		return nil, err
+	}
+	cmd.Span.End = t.span.End
+	cmd.Redirs, err = sp.parseRedirects(&cmd.Span)
+	return cmd, err
+}
+
+// parseFunc parses the rest of a function definition after its name.
+func (sp *scriptParser) parseFunc(name *Word) (CommandNode, error) {
+	sp.has = false
+	t, err := sp.next()
+	if err != nil {
+		return nil, err
+	}
+	if !t.isOp(")") {
+		return nil, sp.unexpected(t)
+	}
+	if err := sp.linebreak(); err != nil {
+		return nil, err
+	}
+	body, err := sp.parseCommand()
+	if err != nil {
+		return nil, err
+	}
+	switch body.(type) {
+	case *SimpleCommand, *FuncDecl:
+		return nil, &SyntaxError{Span: body.Pos(), Msg: "function body must be a compound command"}
+	}
+	return &FuncDecl{Name: name, Body: body, Span: Span{Start: name.Span.Start, End: body.Pos().End}}, nil
+}
+
+func (sp *scriptParser) isRedirect(t scriptToken) bool {
+	return t.kind == tIONumber || t.kind == tOp && redirectOps[t.val]
+}
+
+func (sp *scriptParser) parseRedirects(span *Span) ([]*Redirect, error) {
+	var redirs []*Redirect
+	for {
+		t, err := sp.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !sp.isRedirect(t) {
+			return redirs, nil
+		}
+		r, err := sp.parseRedirect()
+		if err != nil {
+			return nil, err
+		}
+		redirs = append(redirs, r)
+		span.End = r.Target.Span.End
+	}
+}
+
+func (sp *scriptParser) parseRedirect() (*Redirect, error) {
+	t, err := sp.next()
+	if err != nil {
+		return nil, err
+	}
+	r := &Redirect{N: -1, Span: t.span}
+	if t.kind == tIONumber {
+		if r.N, err = strconv.Atoi(t.val); err != nil {
+			return nil, &SyntaxError{Span: t.span, Msg: "bad file descriptor " + t.val}
+		}
+		if t, err = sp.next(); err != nil {
+			return nil, err
+		}
+	}
+	r.Op = t.val
+	target, err := sp.next()
+	if err != nil {
+		return nil, err
+	}
+	if target.kind != tWord {
+		return nil, sp.unexpected(target)
+	}
+	r.Target = &Word{Raw: target.val, Span: target.span}
+	r.Span.End = target.span.End
+	if r.Op == "<<" || r.Op == "<<-" {
+		sp.lx.heredocs = append(sp.lx.heredocs, r)
+	}
+	return r, nil
+}
+
+// isAssignment reports whether the word as written is NAME=value.
+func isAssignment(raw string) bool {
+	eq := strings.IndexByte(raw, '=')
+	return eq > 0 && isName(raw[:eq])
+}
+
+func (sp *scriptParser) parseSimpleCommand() (CommandNode, error) {
+	cmd := &SimpleCommand{}
+	first, aliased := true, false
+	for {
+		t, err := sp.peek()
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			cmd.Span = t.span
+		}
+		switch {
+		case sp.isRedirect(t):
+			r, err := sp.parseRedirect()
+			if err != nil {
+				return nil, err
+			}
+			cmd.Redirs = append(cmd.Redirs, r)
+			cmd.Span.End = r.Target.Span.End
+		case t.kind == tWord && len(cmd.Args) == 0 && !isAssignment(t.val) && !t.alias && !aliased:
+			// The command name after assignments may be an alias.
+			aliased = true
+			if _, err := sp.alias(); err != nil {
+				return nil, err
+			}
+			continue
+		case t.kind == tWord:
+			sp.has = false
+			w := &Word{Raw: t.val, Span: t.span}
+			if len(cmd.Args) == 0 && isAssignment(t.val) {
+				cmd.Assigns = append(cmd.Assigns, w)
+			} else {
+				cmd.Args = append(cmd.Args, w)
+			}
+			cmd.Span.End = t.span.End
+		case t.isOp("(") && len(cmd.Args) == 1 && len(cmd.Assigns) == 0 && len(cmd.Redirs) == 0 && isName(cmd.Args[0].Raw):
+			return sp.parseFunc(cmd.Args[0])
+		default:
+			if first {
+				return nil, sp.unexpected(t)
+			}
+			return cmd, nil
+		}
+		first = false
+	}
+}
+
+// ParseScript parses script with the POSIX shell grammar: lists, pipelines,
+// simple commands, subshells, brace groups, if, case, for, while and until
+// and function definitions. Words are kept as they are
+// written; use ExpandWord to get their values with the options of p.
+func (p *Parser) ParseScript(script string) (*List, error) {
+	sp := &scriptParser{p: p, lx: &scriptLexer{p: p, src: script}}
+	list, err := sp.parseList()
+	if err != nil {
+		return nil, err
+	}
+	t, err := sp.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != tEOF {
+		return nil, sp.unexpected(t)
+	}
+	return list, nil
+}
+
+// ExpandWord returns the values of w, expanded with the options of p.
+func (p *Parser) ExpandWord(w *Word) ([]string, error) {
+	q := *p
+	q.ParseLineContinuation = true
+	q.ParseComment = false
+	return q.Parse(w.Raw)
+}
+
+// ParseScript parses script with the default parser.
+func ParseScript(script string) (*List, error) {
+	return NewParser().ParseScript(script)
+}
@@ -0,0 +1,293 @@
+package shellwords
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dump writes the tree in a compact form to compare in tests.
+func dump(n interface{}) string {
+	var b strings.Builder
+	dumpNode(&b, n)
+	return b.String()
+}
+
+func dumpNode(b *strings.Builder, n interface{}) {
+	switch n := n.(type) {
+	case *List:
+		for i, ao := range n.Items {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			dumpNode(b, ao)
+		}
+	case *AndOr:
+		for i, pl := range n.Pipelines {
+			if i > 0 {
+				fmt.Fprintf(b, " %s ", n.Ops[i-1])
+			}
+			dumpNode(b, pl)
+		}
+		if n.Background {
+			b.WriteString(" &")
+		} else {
+			b.WriteString(";")
+		}
+	case *Pipeline:
+		if n.Bang {
+			b.WriteString("! ")
+		}
+		for i, cmd := range n.Cmds {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			dumpNode(b, cmd)
+		}
+	case *SimpleCommand:
+		var words []string
+		for _, w := range n.Assigns {
+			words = append(words, "="+w.Raw)
+		}
+		for _, w := range n.Args {
+			words = append(words, w.Raw)
+		}
+		b.WriteString("[" + strings.Join(words, " ") + "]")
+		dumpRedirs(b, n.Redirs)
+	case *Subshell:
+		b.WriteString("(")
+		dumpNode(b, n.Body)
+		b.WriteString(")")
+		dumpRedirs(b, n.Redirs)
+	case *BraceGroup:
+		b.WriteString("{")
+		dumpNode(b, n.Body)
+		b.WriteString("}")
+		dumpRedirs(b, n.Redirs)
+	case *IfClause:
+		b.WriteString("if ")
+		dumpNode(b, n.Cond)
+		b.WriteString(" then ")
+		dumpNode(b, n.Then)
+		for _, elif := range n.Elifs {
+			b.WriteString(" elif ")
+			dumpNode(b, elif.Cond)
+			b.WriteString(" then ")
+			dumpNode(b, elif.Then)
+		}
+		if n.Else != nil {
+			b.WriteString(" else ")
+			dumpNode(b, n.Else)
+		}
+		b.WriteString(" fi")
+		dumpRedirs(b, n.Redirs)
+	case *CaseClause:
+		b.WriteString("case " + n.Word.Raw + " in")
+		for _, item := range n.Items {
+			var patterns []string
+			for _, w := range item.Patterns {
+				patterns = append(patterns, w.Raw)
+			}
+			b.WriteString(" " + strings.Join(patterns, "|") + ") ")
+			dumpNode(b, item.Body)
+			b.WriteString(";;")
+		}
+		b.WriteString(" esac")
+		dumpRedirs(b, n.Redirs)
+	case *ForClause:
+		b.WriteString("for " + n.Name.Raw)
+		if n.In {
+			b.WriteString(" in")
+			for _, w := range n.Items {
+				b.WriteString(" " + w.Raw)
+			}
+		}
+		b.WriteString(" do ")
+		dumpNode(b, n.Body)
+		b.WriteString(" done")
+		dumpRedirs(b, n.Redirs)
+	case *WhileClause:
+		if n.Until {
+			b.WriteString("until ")
+		} else {
+			b.WriteString("while ")
+		}
+		dumpNode(b, n.Cond)
+		b.WriteString(" do ")
+		dumpNode(b, n.Body)
+		b.WriteString(" done")
+		dumpRedirs(b, n.Redirs)
+	case *FuncDecl:
+		b.WriteString(n.Name.Raw + "() ")
+		dumpNode(b, n.Body)
+	default:
+		fmt.Fprintf(b, "%T", n)
+	}
+}
+
+func dumpRedirs(b *strings.Builder, redirs []*Redirect) {
+	for _, r := range redirs {
+		b.WriteString(" ")
+		if r.N >= 0 {
+			fmt.Fprint(b, r.N)
+		}
+		b.WriteString(r.Op + r.Target.Raw)
+		if r.Op == "<<" || r.Op == "<<-" {
+			fmt.Fprintf(b, "%q", r.Heredoc)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	var tests = []struct {
+		script string
+		want   string
+	}{
+		{`echo a b`, `[echo a b];`},
+		{`FOO=1 BAR="x y" cmd FOO=2`, `[=FOO=1 =BAR="x y" cmd FOO=2];`},
+		{"a; b & c\n\nd", `[a]; [b] & [c]; [d];`},
+		{`a && b || ! c | d`, `[a] && [b] || ! [c] | [d];`},
+		{"a |\n b &&\n c", `[a] | [b] && [c];`},
+		{`(cd dir && make)`, `([cd dir] && [make];);`},
+		{`(a; (b)) >out 2>&1`, `([a]; ([b];);) >out 2>&1;`},
+		{`{ a; b; } | c`, `{[a]; [b];} | [c];`},
+		{"{\n a\n}", `{[a];};`},
+		{`echo { } {a,b}`, `[echo { } {a,b}];`},
+		{`{ echo }; }`, `{[echo }];};`},
+		{`echo "a;b" 'c|d' $(x; y) ${z} \; # comment`, `[echo "a;b" 'c|d' $(x; y) ${z} \;];`},
+		{`cat <<EOF; echo
+hello $x
+EOF
+next`, `[cat] <<EOF"hello $x\n"; [echo]; [next];`},
+		{"{ cat <<-'E'\n\tx\n\tE\n}", `{[cat] <<-'E'"x\n";};`},
+		{`x=1`, `[=x=1];`},
+		{`echo ${x:-'}'} "${y:-"}"}" ${z:-${w}}`, `[echo ${x:-'}'} "${y:-"}"}" ${z:-${w}}];`},
+		{`echo "${x:-'}" '}'`, `[echo "${x:-'}" '}'];`},
+		{``, ``},
+	}
+	for _, test := range tests {
+		list, err := ParseScript(test.script)
+		if err != nil {
+			t.Fatalf("%q: %v", test.script, err)
+		}
+		if got := dump(list); got != test.want {
+			t.Fatalf("%q: Expected %s, but %s", test.script, test.want, got)
+		}
+	}
+}
+
+func TestParseScriptError(t *testing.T) {
+	for _, script := range []string{
+		`(a`, `a)`, `()`, `{ a }`, `{ }`, `a &&`, `| a`, `a >`, `echo "a`, `echo $(a`, `a; ;`,
+		"cat <<EOF", "cat <<EOF\nbody\n", "cat <<EOF <<X\nEOF\n", "cat <<-EOF\n\tEOFX\n",
+	} {
+		_, err := ParseScript(script)
+		if err == nil {
+			t.Fatalf("%q: Should be an error", script)
+		}
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Fatalf("%q: Expected *SyntaxError, but %T", script, err)
+		}
+	}
+}
+
+func TestParseScriptCompound(t *testing.T) {
+	var tests = []struct {
+		script string
+		want   string
+	}{
+		{`if a; then b; fi`, `if [a]; then [b]; fi;`},
+		{"if a\nthen\n  b\nelif c; then d; elif e; then f\nelse g; fi >out", `if [a]; then [b]; elif [c]; then [d]; elif [e]; then [f]; else [g]; fi >out;`},
+		{`if if a; then b; fi; then echo fi then; fi`, `if if [a]; then [b]; fi; then [echo fi then]; fi;`},
+		{"case $x in\n(a|b) echo ab;;\n*.go) ;;\n'esac') c\nesac", `case $x in a|b) [echo ab];;; *.go) ;; 'esac') [c];;; esac;`},
+		{`case x in esac`, `case x in esac;`},
+		{`for f in *.go "a b"; do gofmt $f; done`, `for f in *.go "a b" do [gofmt $f]; done;`},
+		{"for f\ndo echo $f\ndone", `for f do [echo $f]; done;`},
+		{`for f; do :; done`, `for f do [:]; done;`},
+		{`for f in; do :; done`, `for f in do [:]; done;`},
+		{`while read l; do echo $l; done <in | sort`, `while [read l]; do [echo $l]; done <in | [sort];`},
+		{`until false; do break; done &`, `until [false]; do [break]; done &`},
+		{"f() { echo f; }\nf", `f() {[echo f];}; [f];`},
+		{"g ()\n(a) 2>/dev/null", `g() ([a];) 2>/dev/null;`},
+		{`echo if then do done case esac`, `[echo if then do done case esac];`},
+		{`'if' a`, `['if' a];`},
+	}
+	for _, test := range tests {
+		list, err := ParseScript(test.script)
+		if err != nil {
+			t.Fatalf("%q: %v", test.script, err)
+		}
+		if got := dump(list); got != test.want {
+			t.Fatalf("%q: Expected %s, but %s", test.script, test.want, got)
+		}
+	}
+
+	for _, script := range []string{
+		`if a; fi`, `if a; then fi`, `if a; then b`, `then`, `fi`, `done`, `}`,
+		`case x in a) b`, `case x a) b;; esac`, `case x in a b) c;; esac`,
+		`for 1 in a; do b; done`, `for a in b c do d; done`, `while a; done`, `until a; do done`,
+		`f() echo`, `f(x) { a; }`,
+	} {
+		_, err := ParseScript(script)
+		if err == nil {
+			t.Fatalf("%q: Should be an error", script)
+		}
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Fatalf("%q: Expected *SyntaxError, but %T", script, err)
+		}
+	}
+}
+
+func TestParseScriptSpan(t *testing.T) {
+	script := `x; (cd dir) >log`
+	list, err := ParseScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := list.Items[1].Pipelines[0].Cmds[0].(*Subshell)
+	if got := script[cmd.Span.Start:cmd.Span.End]; got != `(cd dir) >log` {
+		t.Fatalf("Expected %q, but %q", `(cd dir) >log`, got)
+	}
+	w := cmd.Body.Items[0].Pipelines[0].Cmds[0].(*SimpleCommand).Args[1]
+	if got := script[w.Span.Start:w.Span.End]; got != "dir" {
+		t.Fatalf("Expected %q, but %q", "dir", got)
+	}
+
+	script = `if a; then b; fi >x; case y in z) ;; esac`
+	if list, err = ParseScript(script); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{`if a; then b; fi >x`, `case y in z) ;; esac`} {
+		span := list.Items[i].Pipelines[0].Cmds[0].Pos()
+		if got := script[span.Start:span.End]; got != want {
+			t.Fatalf("Expected %q, but %q", want, got)
+		}
+	}
+}
+
+func TestExpandWord(t *testing.T) {
+	parser := NewParser()
+	parser.ParseEnv = true
+	parser.Getenv = func(name string) string {
+		if name == "X" {
+			return "a b"
+		}
+		return ""
+	}
+	list, err := parser.ParseScript(`echo "$X" $X 'c d'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args []string
+	for _, w := range list.Items[0].Pipelines[0].Cmds[0].(*SimpleCommand).Args {
+		values, err := parser.ExpandWord(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, values...)
+	}
+	if want := []string{"echo", "a b", "a", "b", "c d"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v:", want, args)
+	}
+}
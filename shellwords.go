@@ -3,7 +3,10 @@ package shellwords
 import (
 	"bytes"
 	"errors"
+	"io"
+	"io/fs"
 	"os"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -101,10 +104,135 @@ type Parser struct {
 	Dir           string
 
 	// If ParseEnv is true, use this for getenv.
-	// If nil, use os.Getenv.
+	// If nil, look in Env, or use os.Getenv if Env is nil too.
 	Getenv func(string) string
+
+	// If Tolerant is true, problems in the line don't abort parsing.
+	// Unterminated quotes and substitutions are closed at the end of the
+	// line, and what was wrong is recorded in Diagnostics.
+	Tolerant bool
+
+	// Diagnostics holds the problems found by the last call to Parse.
+	Diagnostics []Diagnostic
+
+	// If ParseComment is true, '#' at the start of a word begins a
+	// comment which runs to the end of the line.
+	ParseComment bool
+
+	// If KeepComment is true, ParseTokens returns comments as tokens of
+	// kind TokenComment. Parse never returns them.
+	KeepComment bool
+
+	// If ParseLineContinuation is true, a backslash followed by a newline
+	// is removed instead of producing a newline character.
+	ParseLineContinuation bool
+
+	// Escape selects how backslashes are interpreted. See EscapeMode.
+	Escape EscapeMode
+
+	// If ParseANSIC is true, $'...' is decoded like bash does, with
+	// backslash escapes such as \n, \x41 and \u263a, and $"..." is
+	// handled as "...".
+	ParseANSIC bool
+
+	// If ParseBrace is true, unquoted braces are expanded like bash:
+	// a{b,c}d becomes abd acd, and {1..10..2} and {a..e} are sequences.
+	// A sequence of more than 65536 items is left as it is, and a word
+	// which would expand to more than 65536 words is an error.
+	ParseBrace bool
+
+	// If ParseTilde is true, ~ at the start of a word and after '=' or
+	// ':' in an assignment is expanded: ~ to $HOME, ~+ to $PWD, ~- to
+	// $OLDPWD and ~user to the home directory of user.
+	ParseTilde bool
+
+	// If ParseTilde is true, use this to find the home directory of a
+	// user. If nil, use os/user.
+	LookupHome func(user string) (string, error)
+
+	// If ParseArith is true, $((expr)) is replaced by the value of expr,
+	// which is computed by EvalArith without running anything, even if
+	// ParseBacktick is false.
+	ParseArith bool
+
+	// If ParseArith is true, use this to assign variables in expressions
+	// such as $((i += 1)). If nil, assignments are an error.
+	Setenv func(name, value string) error
+
+	// If ParseProcSubst is true, <(command) and >(command) at the start
+	// of a word are process substitutions. ParseTokens returns them as
+	// TokenProcSubstIn and TokenProcSubstOut. Parse replaces them with the
+	// path ProcSubst gives, or keeps them as written if it is nil.
+	ParseProcSubst bool
+
+	// ProcSubst runs the commands of process substitutions for Parse. If
+	// the line fails after one started and ProcSubst is an io.Closer, it
+	// is closed to stop those already started.
+	ProcSubst ProcSubstExecutor
+
+	// If ParseGlob is true, unquoted words containing *, ? or [...] are
+	// replaced by the sorted list of pathnames they match.
+	ParseGlob bool
+
+	// Glob changes how ParseGlob matches pathnames.
+	Glob GlobFlags
+
+	// If ParseGlob is true, match pathnames in this file system.
+	// If nil, use the OS file system at Dir. Patterns which start with /
+	// or go up with .. are not in FS, so they are left as they are.
+	FS fs.FS
+
+	// If RejectUnsupported is true, Parse fails with an *UnsupportedError
+	// when the line starts with a shell construct which it does not model,
+	// such as a reserved word, a subshell or a line of only assignments.
+	RejectUnsupported bool
+
+	// Aliases replace the first word of a command, as alias does in the
+	// shell. The expansion of an alias ending with a blank has the next
+	// word checked for an alias too.
+	Aliases map[string]string
+
+	// If ParseHistory is true, Parse performs history expansion with the
+	// lines of History first. See ExpandHistory.
+	ParseHistory bool
+
+	// History holds the lines !! and !n refer to for ParseHistory. A nil
+	// History has no events, so any event fails.
+	History History
+
+	// If AssignArgs is true, the assignments written before the command,
+	// as in FOO=1 cmd $FOO, are seen by the expansions in its arguments.
+	// The shell does not do this. Either way, an assignment sees the ones
+	// before it.
+	AssignArgs bool
+
+	// Env is the environment which Command adds the assignments before
+	// the command to, and where variables are looked up if Getenv is nil.
+	// If nil, use os.Environ().
+	Env []string
+
+	// The assignments the expansion being done can see.
+	assigned map[string]string
 }
 
+// EscapeMode selects the rules for backslashes and double quotes.
+type EscapeMode int
+
+const (
+	// EscapeLegacy is the behaviour Parse has always had: a backslash
+	// escapes any character, even inside double quotes, and \t and \n
+	// stand for a tab and a newline.
+	EscapeLegacy EscapeMode = iota
+
+	// EscapePOSIX follows the POSIX shell. Outside of quotes a backslash
+	// escapes the next character and is removed along with a following
+	// newline. Inside double quotes it only escapes $, `, ", \ and
+	// newline, and is kept before anything else. With ParseEnv, variables
+	// are expanded where they are written: not in single quotes, and
+	// without field splitting in double quotes.
+	EscapePOSIX
+)
+
 func NewParser() *Parser {
 	return &Parser{
 		ParseEnv:      ParseEnv,
@@ -114,6 +242,24 @@ func NewParser() *Parser {
 	}
 }
 
+// TokenKind tells what a Token is.
+type TokenKind int
+
+const (
+	TokenWord TokenKind = iota
+	TokenComment
+	TokenProcSubstIn  // <(command)
+	TokenProcSubstOut // >(command)
+)
+
+// Token is a word of the line along with where it was found. For process
+// substitutions, Value is the command inside the parentheses.
+type Token struct {
+	Kind  TokenKind
+	Value string
+	Span  Span
+}
+
 type argType int
 
 const (
@@ -122,86 +268,391 @@ const (
 	argQuoted
 )
 
+var errInvalidLine = errors.New("invalid command line string")
+
+var errTooManyBraces = errors.New("brace expansion makes too many words")
+
 func (p *Parser) Parse(line string) ([]string, error) {
-	args := []string{}
-	buf := ""
-	var escaped, doubleQuoted, singleQuoted, backQuote, dollarQuote bool
+	tokens, err := p.ParseTokens(line)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Kind == TokenComment {
+			continue
+		}
+		arg, err := p.arg(line, token)
+		if err != nil {
+			p.closeProcSubst()
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// closeProcSubst closes ProcSubst if it is an io.Closer, to stop the
+// process substitutions it started for a line which failed.
+func (p *Parser) closeProcSubst() {
+	if c, ok := p.ProcSubst.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// arg returns the argument which token stands for. Process substitutions
+// are started if there is a ProcSubst to run them.
+func (p *Parser) arg(line string, token Token) (string, error) {
+	switch token.Kind {
+	case TokenProcSubstIn, TokenProcSubstOut:
+		if p.ProcSubst == nil {
+			return line[token.Span.Start:token.Span.End], nil
+		}
+		return p.ProcSubst.Start(token.Value, token.Kind == TokenProcSubstOut)
+	}
+	return token.Value, nil
+}
+
+// ParseTokens is like Parse but returns the words along with their spans.
+// Words which come from splitting an expanded variable share the span of
+// the word they were written in.
+func (p *Parser) ParseTokens(line string) ([]Token, error) {
+	if !p.ParseHistory {
+		return p.parseAliasTokens(line)
+	}
+	var regions []region
+	expanded, print, err := p.expandHistory(line, &regions)
+	if err != nil {
+		return nil, err
+	}
+	if print {
+		return nil, &HistoryPrintError{Line: expanded}
+	}
+	return p.parseExpanded(line, expanded, regions, p.parseAliasTokens)
+}
+
+func (p *Parser) parseTokens(line string) ([]Token, error) {
+	p.Diagnostics = nil
+	if p.RejectUnsupported {
+		if err := p.checkSupported(line); err != nil {
+			return nil, err
+		}
+	}
+	posix := p.Escape == EscapePOSIX
+	tokens := []Token{}
+	var buf word
+	var escaped, doubleQuoted, singleQuoted, backQuote, dollarQuote, comment bool
 	backtick := ""
+	extGlob := 0
 
 	pos := -1
 	got := argNo
+	start := -1
+	skip := 0
+	var escapeAt, quoteAt, backQuoteAt, dollarQuoteAt int
+
+	dollarBefore := func() bool {
+		n := buf.len()
+		return p.ParseANSIC && !backQuote && n > 0 && buf.s[n-1] == '$' && buf.mask[n-1] == unquoted
+	}
+
+	endComment := func(end int) {
+		if p.KeepComment {
+			tokens = append(tokens, Token{Kind: TokenComment, Value: line[start:end], Span: Span{Start: start, End: end}})
+		}
+		comment = false
+		start = -1
+	}
+
+	// Assignments before the command are seen by the words after them, but
+	// not by the arguments unless AssignArgs is set.
+	assigned := map[string]string{}
+	prefix := true
+	assignment := false
+	defer func() { p.assigned = nil }()
+	scope := func(raw string) {
+		p.assigned = nil
+		if p.AssignArgs || prefix && isAssignment(raw) {
+			p.assigned = assigned
+		}
+	}
+
+	emitWord := func(end int) error {
+		span := Span{Start: start, End: end}
+		start = -1
+		add := func(w word) error {
+			values := []string{w.s}
+			if p.ParseGlob {
+				var err error
+				if values, err = p.expandGlob(w, span); err != nil {
+					return err
+				}
+			}
+			for _, value := range values {
+				tokens = append(tokens, Token{Value: value, Span: span})
+			}
+			return nil
+		}
+		expand := func(w word) error {
+			var dirs []Span
+			if p.ParseTilde {
+				dirs = p.expandTilde(&w)
+			}
+			if posix {
+				for _, f := range w.fields() {
+					if err := add(f); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if !p.ParseEnv {
+				return add(w)
+			}
+			if got == argSingle {
+				parser := &Parser{ParseEnv: false, ParseBacktick: false, Position: 0, Dir: p.Dir, Tolerant: p.Tolerant,
+					ParseGlob: p.ParseGlob, Glob: p.Glob, FS: p.FS}
+				strs, err := parser.Parse(replaceEnv(p.getenv, protectTilde(w.s, dirs, true)))
+				if err != nil {
+					return err
+				}
+				for _, d := range parser.Diagnostics {
+					p.Diagnostics = append(p.Diagnostics, Diagnostic{Span: span, Severity: SeverityWarning, Message: "expanded value: " + d.Message})
+				}
+				for _, s := range strs {
+					tokens = append(tokens, Token{Value: s, Span: span})
+				}
+			} else if value := replaceEnv(p.getenv, protectTilde(w.s, dirs, false)); value != w.s {
+				tokens = append(tokens, Token{Value: value, Span: span})
+			} else {
+				return add(w)
+			}
+			return nil
+		}
+
+		if assignment {
+			// An assignment is one word: its value is not split, and has
+			// no globs or braces.
+			w := buf
+			var dirs []Span
+			if p.ParseTilde {
+				dirs = p.expandTilde(&w)
+			}
+			value := w.s
+			if !posix && p.ParseEnv {
+				value = replaceEnv(p.getenv, protectTilde(w.s, dirs, false))
+			}
+			tokens = append(tokens, Token{Value: value, Span: span})
+			return nil
+		}
+		if !p.ParseBrace {
+			return expand(buf)
+		}
+		words, ok := expandBrace(buf)
+		if !ok {
+			if err := p.fail(span, errTooManyBraces); err != nil {
+				return err
+			}
+			return expand(buf)
+		}
+		for _, w := range words {
+			if len(words) > 1 && w.len() == 0 && len(w.nulls) == 0 {
+				continue
+			}
+			if err := expand(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	emit := func(end int) error {
+		raw := ""
+		if start >= 0 {
+			raw = line[start:end]
+		}
+		scope(raw)
+		n := len(tokens)
+		assignment = prefix && isAssignment(raw)
+		if err := emitWord(end); err != nil {
+			return err
+		}
+		if eq := strings.IndexByte(raw, '='); prefix && isAssignment(raw) && len(tokens) > n && strings.HasPrefix(tokens[n].Value, raw[:eq+1]) {
+			assigned[raw[:eq]] = tokens[n].Value[eq+1:]
+		} else {
+			prefix = false
+		}
+		return nil
+	}
+
+	substitute := func(at, end int) (string, error) {
+		out, err := shellRun(backtick, p.Dir)
+		if err != nil {
+			return "", p.fail(Span{Start: at, End: end}, err)
+		}
+		return out, nil
+	}
 
 	i := -1
 loop:
-	for _, r := range line {
+	for off, r := range line {
 		i++
+		if off < skip {
+			continue
+		}
+		if comment {
+			if r == '\n' {
+				endComment(off)
+			}
+			continue
+		}
+		if start < 0 && (escaped || singleQuoted || doubleQuoted || backQuote || dollarQuote || !isSpace(r)) {
+			start = off
+		}
 		if escaped {
+			escaped = false
+			if r == '\n' && (p.ParseLineContinuation || posix) {
+				if got == argNo && !singleQuoted && !doubleQuoted && !backQuote && !dollarQuote {
+					start = -1
+				}
+				continue
+			}
+			got = argSingle
+			if posix {
+				// The text of a command substitution is kept as written,
+				// except for the backslashes backquotes remove.
+				if dollarQuote || backQuote && !strings.ContainsRune("$`\\", r) {
+					buf.add("\\"+string(r), quoted)
+					backtick += "\\" + string(r)
+				} else if backQuote {
+					buf.add(string(r), quoted)
+					backtick += string(r)
+				} else {
+					buf.add(string(r), quoted)
+				}
+				continue
+			}
 			if r == 't' {
 				r = '\t'
 			}
 			if r == 'n' {
 				r = '\n'
 			}
-			buf += string(r)
-			escaped = false
-			got = argSingle
+			buf.add(string(r), quoted)
 			continue
 		}
 
 		if r == '\\' {
 			if singleQuoted {
-				buf += string(r)
+				buf.add(string(r), quoted)
+			} else if posix && doubleQuoted && (off+1 == len(line) || !strings.ContainsRune("$`\"\\\n", rune(line[off+1]))) {
+				// In double quotes, a backslash only escapes the characters
+				// which are special there.
+				buf.add(string(r), quoted)
+				got = argSingle
 			} else {
 				escaped = true
+				escapeAt = off
 			}
 			continue
 		}
 
 		if isSpace(r) {
 			if singleQuoted || doubleQuoted || backQuote || dollarQuote {
-				buf += string(r)
+				buf.add(string(r), quoted)
 				backtick += string(r)
 			} else if got != argNo {
-				if p.ParseEnv {
-					if got == argSingle {
-						parser := &Parser{ParseEnv: false, ParseBacktick: false, Position: 0, Dir: p.Dir}
-						strs, err := parser.Parse(replaceEnv(p.Getenv, buf))
-						if err != nil {
-							return nil, err
-						}
-						args = append(args, strs...)
-					} else {
-						args = append(args, replaceEnv(p.Getenv, buf))
-					}
-				} else {
-					args = append(args, buf)
+				if err := emit(off); err != nil {
+					return nil, err
 				}
-				buf = ""
+				buf.reset()
 				got = argNo
 			}
 			continue
 		}
 
 		switch r {
+		case '#':
+			if p.ParseComment && got == argNo && buf.len() == 0 && !(singleQuoted || doubleQuoted || backQuote || dollarQuote) {
+				comment = true
+				continue
+			}
+
+		case '$':
+			if p.ParseArith && !singleQuoted && !backQuote && !dollarQuote && strings.HasPrefix(line[off:], "$((") {
+				got = argSingle
+				end := arithEnd(line, off)
+				if end < 0 {
+					if err := p.report(Span{Start: off, End: len(line)}, SeverityError, "unterminated arithmetic expansion"); err != nil {
+						return nil, err
+					}
+					buf.add(line[off:], quoted)
+					skip = len(line)
+					continue
+				}
+				scope(line[start:off])
+				v, err := p.EvalArith(line[off+3 : end-2])
+				if err != nil {
+					if err := p.fail(Span{Start: off, End: end}, err); err != nil {
+						return nil, err
+					}
+					buf.add(line[off:end], quoted)
+				} else if doubleQuoted {
+					buf.add(strconv.FormatInt(v, 10), quoted)
+				} else {
+					buf.add(strconv.FormatInt(v, 10), expanded)
+				}
+				skip = end
+				continue
+			}
+			if posix && p.ParseEnv && !singleQuoted && !backQuote && !dollarQuote {
+				scope(line[start:off])
+				value, end, ok, err := p.expandParam(line, off)
+				if err != nil {
+					if err := p.report(Span{Start: off, End: len(line)}, SeverityError, err.Error()); err != nil {
+						return nil, err
+					}
+					break
+				}
+				if !ok {
+					break
+				}
+				if doubleQuoted {
+					buf.add(value, quoted)
+				} else {
+					buf.add(value, expanded)
+				}
+				got = argSingle
+				skip = end
+				continue
+			}
+
 		case '`':
 			if !singleQuoted && !doubleQuoted && !dollarQuote {
 				if p.ParseBacktick {
 					if backQuote {
-						out, err := shellRun(backtick, p.Dir)
+						out, err := substitute(backQuoteAt, off+1)
 						if err != nil {
 							return nil, err
 						}
-						buf = buf[:len(buf)-len(backtick)] + out
+						buf.truncate(buf.len() - len(backtick))
+						buf.add(out, expanded)
 					}
 					backtick = ""
 					backQuote = !backQuote
+					backQuoteAt = off
 					continue
 				}
 				backtick = ""
 				backQuote = !backQuote
+				backQuoteAt = off
 			}
 
 		case ')':
+			if extGlob > 0 && !singleQuoted && !doubleQuoted {
+				extGlob--
+				break
+			}
 			if !singleQuoted && !doubleQuoted && !backQuote {
 				if p.ParseBacktick {
 					// Security fix:
@@ -209,21 +660,25 @@ loop:
 					// Preserve prior behavior by rejecting unmatched ')'
 					// when command substitution parsing is enabled.
 					if !dollarQuote {
-						return nil, errors.New("invalid command line string")
+						if err := p.report(Span{Start: off, End: off + 1}, SeverityError, "unmatched ')'"); err != nil {
+							return nil, err
+						}
+						break
 					}
 
-					out, err := shellRun(backtick, p.Dir)
+					out, err := substitute(dollarQuoteAt, off+1)
 					if err != nil {
 						return nil, err
 					}
 
 					// Defensive guard: valid $(...) implies the buffer must contain
 					// the "$(" prefix plus the collected command body.
-					if len(buf) < len(backtick)+2 {
-						return nil, errors.New("invalid command line string")
+					if buf.len() < len(backtick)+2 {
+						return nil, errInvalidLine
 					}
 
-					buf = buf[:len(buf)-len(backtick)-2] + out
+					buf.truncate(buf.len() - len(backtick) - 2)
+					buf.add(out, expanded)
 					backtick = ""
 					dollarQuote = false
 					continue
@@ -233,10 +688,13 @@ loop:
 				// A bare ')' is a syntax error, consistent with '(' handling.
 				// Only close an already-open $(...) region.
 				if !dollarQuote {
-					return nil, errors.New("invalid command line string")
+					if err := p.report(Span{Start: off, End: off + 1}, SeverityError, "unmatched ')'"); err != nil {
+						return nil, err
+					}
+					break
 				}
 
-				buf += string(r)
+				buf.add(string(r), unquoted)
 				backtick = ""
 				dollarQuote = false
 				got = argSingle
@@ -244,103 +702,215 @@ loop:
 			}
 
 		case '(':
+			if !singleQuoted && !doubleQuoted && !backQuote && !dollarQuote && p.ParseGlob && p.Glob&GlobExt != 0 {
+				if n := buf.len(); extGlob > 0 || n > 0 && buf.mask[n-1] == unquoted && strings.IndexByte("?*+@!", buf.s[n-1]) >= 0 {
+					extGlob++
+					break
+				}
+			}
 			if !singleQuoted && !doubleQuoted && !backQuote {
-				if !dollarQuote && strings.HasSuffix(buf, "$") {
+				if !dollarQuote && strings.HasSuffix(buf.s, "$") {
 					dollarQuote = true
-					buf += "("
+					dollarQuoteAt = off - 1
+					buf.add("(", unquoted)
 					continue
 				} else {
-					return nil, errors.New("invalid command line string")
+					if err := p.report(Span{Start: off, End: off + 1}, SeverityError, "unexpected '('"); err != nil {
+						return nil, err
+					}
 				}
 			}
 
 		case '"':
 			if !singleQuoted && !dollarQuote {
+				if !doubleQuoted && dollarBefore() {
+					buf.truncate(buf.len() - 1)
+				}
 				if doubleQuoted {
 					got = argQuoted
+					buf.null()
 				}
 				doubleQuoted = !doubleQuoted
+				quoteAt = off
 				continue
 			}
 
 		case '\'':
 			if !doubleQuoted && !dollarQuote {
+				if !singleQuoted && dollarBefore() {
+					buf.truncate(buf.len() - 1)
+					value, end, err := decodeANSIC(line, off+1)
+					if err != nil {
+						if err := p.report(Span{Start: off - 1, End: end}, SeverityError, err.Error()); err != nil {
+							return nil, err
+						}
+					}
+					buf.add(value, quoted)
+					buf.null()
+					got = argQuoted
+					skip = end
+					continue
+				}
 				if singleQuoted {
 					got = argQuoted
+					buf.null()
 				}
 				singleQuoted = !singleQuoted
+				quoteAt = off
 				continue
 			}
 
 		case ';', '&', '|', '<', '>':
+			if r == '|' && extGlob > 0 {
+				break
+			}
+			if (r == '<' || r == '>') && p.ParseProcSubst && got == argNo && buf.len() == 0 && strings.HasPrefix(line[off+1:], "(") &&
+				!(singleQuoted || doubleQuoted || backQuote || dollarQuote) {
+				kind := TokenProcSubstIn
+				if r == '>' {
+					kind = TokenProcSubstOut
+				}
+				end := parenEnd(line, off+1)
+				value := ""
+				if end < 0 {
+					if err := p.report(Span{Start: off, End: len(line)}, SeverityError, "unterminated process substitution"); err != nil {
+						return nil, err
+					}
+					end = len(line)
+					value = line[off+2:]
+				} else {
+					value = line[off+2 : end-1]
+				}
+				tokens = append(tokens, Token{Kind: kind, Value: value, Span: Span{Start: off, End: end}})
+				start = -1
+				skip = end
+				continue
+			}
 			if !(escaped || singleQuoted || doubleQuoted || backQuote || dollarQuote) {
-				if r == '>' && len(buf) > 0 {
-					if c := buf[0]; '0' <= c && c <= '9' {
+				if r == '>' && buf.len() > 0 {
+					if c := buf.s[0]; '0' <= c && c <= '9' {
 						i -= 1
 						got = argNo
 					}
 				}
 				pos = i
+				if got != argNo {
+					if err := emit(off); err != nil {
+						return nil, err
+					}
+					got = argNo
+				}
 				break loop
 			}
 		}
 
 		got = argSingle
-		buf += string(r)
+		if singleQuoted || doubleQuoted {
+			buf.add(string(r), quoted)
+		} else {
+			buf.add(string(r), unquoted)
+		}
 		if backQuote || dollarQuote {
 			backtick += string(r)
 		}
 	}
 
-	if got != argNo {
-		if p.ParseEnv {
-			if got == argSingle {
-				parser := &Parser{ParseEnv: false, ParseBacktick: false, Position: 0, Dir: p.Dir}
-				strs, err := parser.Parse(replaceEnv(p.Getenv, buf))
-				if err != nil {
-					return nil, err
-				}
-				args = append(args, strs...)
-			} else {
-				args = append(args, replaceEnv(p.Getenv, buf))
-			}
-		} else {
-			args = append(args, buf)
+	// In tolerant mode, whatever is still open is closed here.
+	end := len(line)
+	if comment {
+		endComment(end)
+	}
+	if escaped {
+		if err := p.report(Span{Start: escapeAt, End: end}, SeverityError, "trailing backslash"); err != nil {
+			return nil, err
+		}
+		buf.add("\\", quoted)
+		got = argSingle
+	}
+	if singleQuoted || doubleQuoted {
+		if err := p.report(Span{Start: quoteAt, End: end}, SeverityError, "unterminated quoted string"); err != nil {
+			return nil, err
+		}
+		buf.null()
+		got = argQuoted
+	}
+	if backQuote {
+		if err := p.report(Span{Start: backQuoteAt, End: end}, SeverityError, "unterminated backquote"); err != nil {
+			return nil, err
+		}
+		got = argSingle
+	}
+	if dollarQuote {
+		if err := p.report(Span{Start: dollarQuoteAt, End: end}, SeverityError, "unterminated command substitution"); err != nil {
+			return nil, err
 		}
+		got = argSingle
 	}
 
-	if escaped || singleQuoted || doubleQuoted || backQuote || dollarQuote {
-		return nil, errors.New("invalid command line string")
+	if got != argNo {
+		if err := emit(end); err != nil {
+			return nil, err
+		}
 	}
 
 	p.Position = pos
 
-	return args, nil
+	return tokens, nil
 }
 
 func (p *Parser) ParseWithEnvs(line string) (envs []string, args []string, err error) {
-	_args, err := p.Parse(line)
+	assigns, args, err := p.ParseWithAssignments(line)
 	if err != nil {
 		return nil, nil, err
 	}
 	envs = []string{}
-	args = []string{}
-	parsingEnv := true
-	for _, arg := range _args {
-		if parsingEnv && isEnv(arg) {
-			envs = append(envs, arg)
-		} else {
-			if parsingEnv {
-				parsingEnv = false
-			}
-			args = append(args, arg)
-		}
+	for _, a := range assigns {
+		envs = append(envs, a.String())
 	}
 	return envs, args, nil
 }
 
-func isEnv(arg string) bool {
-	return len(strings.Split(arg, "=")) == 2
+// Assignment is a variable assignment written before the command, as in
+// FOO=bar cmd.
+type Assignment struct {
+	Name  string
+	Value string
+}
+
+// String returns the assignment as NAME=value.
+func (a Assignment) String() string {
+	return a.Name + "=" + a.Value
+}
+
+// ParseWithAssignments is like ParseWithEnvs but returns the assignments
+// split into name and value. A word is an assignment if it is written as a
+// valid name followed by an unquoted '=', so "FOO=bar" in quotes is an
+// argument. As in the shell, its value is not split into fields and has no
+// globs or braces expanded.
+func (p *Parser) ParseWithAssignments(line string) (assigns []Assignment, args []string, err error) {
+	tokens, err := p.ParseTokens(line)
+	if err != nil {
+		return nil, nil, err
+	}
+	assigns = []Assignment{}
+	args = []string{}
+	for _, token := range tokens {
+		if token.Kind == TokenComment {
+			continue
+		}
+		raw := line[token.Span.Start:token.Span.End]
+		if eq := strings.IndexByte(raw, '='); len(args) == 0 && token.Kind == TokenWord && isAssignment(raw) && strings.HasPrefix(token.Value, raw[:eq+1]) {
+			assigns = append(assigns, Assignment{Name: raw[:eq], Value: token.Value[eq+1:]})
+			continue
+		}
+		arg, err := p.arg(line, token)
+		if err != nil {
+			p.closeProcSubst()
+			return nil, nil, err
+		}
+		args = append(args, arg)
+	}
+	return assigns, args, nil
 }
 
 func Parse(line string) ([]string, error) {
@@ -350,3 +920,7 @@ func Parse(line string) ([]string, error) {
 func ParseWithEnvs(line string) (envs []string, args []string, err error) {
 	return NewParser().ParseWithEnvs(line)
 }
+
+func ParseWithAssignments(line string) (assigns []Assignment, args []string, err error) {
+	return NewParser().ParseWithAssignments(line)
+}
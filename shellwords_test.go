@@ -1,6 +1,7 @@
 package shellwords
 
 import (
+	"context"
 	"errors"
 	"go/build"
 	"os"
@@ -439,6 +440,26 @@ func TestParseWithEnvs(t *testing.T) {
 			wantEnvs: []string{},
 			wantArgs: []string{"cmd", "--args=A=B", "-A=B"},
 		},
+		{
+			line:     "FOO=a=b cmd",
+			wantEnvs: []string{"FOO=a=b"},
+			wantArgs: []string{"cmd"},
+		},
+		{
+			line:     "=x 1X=y my-var=z cmd",
+			wantEnvs: []string{},
+			wantArgs: []string{"=x", "1X=y", "my-var=z", "cmd"},
+		},
+		{
+			line:     `"FOO=bar" BAR=baz cmd`,
+			wantEnvs: []string{},
+			wantArgs: []string{"FOO=bar", "BAR=baz", "cmd"},
+		},
+		{
+			line:     `FOO="a b" BAR= cmd FOO=c`,
+			wantEnvs: []string{"FOO=a b", "BAR="},
+			wantArgs: []string{"cmd", "FOO=c"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.line, func(t *testing.T) {
@@ -456,6 +477,94 @@ func TestParseWithEnvs(t *testing.T) {
 	}
 }
 
+func TestParseWithAssignments(t *testing.T) {
+	assigns, args, err := ParseWithAssignments(`A=1 B='x y' C=a=b F\OO=1 D=2 cmd E=3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Assignment{{"A", "1"}, {"B", "x y"}, {"C", "a=b"}}
+	if !reflect.DeepEqual(assigns, expected) {
+		t.Fatalf("Expected %#v, but %#v", expected, assigns)
+	}
+	if want := []string{"FOO=1", "D=2", "cmd", "E=3"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v", want, args)
+	}
+	if s := assigns[1].String(); s != "B=x y" {
+		t.Fatalf("Expected %q, but %q", "B=x y", s)
+	}
+}
+
+func TestParseWithAssignmentsNoSplit(t *testing.T) {
+	for _, escape := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+		parser := NewParser()
+		parser.ParseEnv = true
+		parser.ParseGlob = true
+		parser.ParseBrace = true
+		parser.FS = globFS
+		parser.Escape = escape
+		parser.Getenv = func(name string) string { return map[string]string{"X": "a b"}[name] }
+		assigns, args, err := parser.ParseWithAssignments(`FOO=$X BAR=*.txt BAZ={a,b} cmd $X`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Assignment{{"FOO", "a b"}, {"BAR", "*.txt"}, {"BAZ", "{a,b}"}}
+		if !reflect.DeepEqual(assigns, expected) {
+			t.Fatalf("Expected %#v, but %#v", expected, assigns)
+		}
+		if want := []string{"cmd", "a", "b"}; !reflect.DeepEqual(args, want) {
+			t.Fatalf("Expected %#v, but %#v", want, args)
+		}
+
+		// The value can't pick the command to run.
+		cmd, err := parser.Command(context.Background(), `FOO=$X go`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"go"}; !reflect.DeepEqual(cmd.Args, want) {
+			t.Fatalf("Expected %#v, but %#v", want, cmd.Args)
+		}
+	}
+}
+
+func TestSequentialAssignments(t *testing.T) {
+	getenv := func(name string) string {
+		return map[string]string{"FOO": "env", "BAR": "env"}[name]
+	}
+	for _, escape := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+		parser := NewParser()
+		parser.ParseEnv = true
+		parser.Escape = escape
+		parser.Getenv = getenv
+		envs, args, err := parser.ParseWithEnvs(`FOO=/opt BAR=$FOO/bin cmd $BAR $FOO`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"FOO=/opt", "BAR=/opt/bin"}; !reflect.DeepEqual(envs, want) {
+			t.Fatalf("Expected %#v, but %#v", want, envs)
+		}
+		if want := []string{"cmd", "env", "env"}; !reflect.DeepEqual(args, want) {
+			t.Fatalf("Expected %#v, but %#v", want, args)
+		}
+
+		parser.AssignArgs = true
+		args, err = parser.Parse(`FOO=/opt BAR=$FOO/bin cmd $BAR`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"FOO=/opt", "BAR=/opt/bin", "cmd", "/opt/bin"}; !reflect.DeepEqual(args, want) {
+			t.Fatalf("Expected %#v, but %#v", want, args)
+		}
+
+		args, err = parser.Parse(`echo $FOO`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"echo", "env"}; !reflect.DeepEqual(args, want) {
+			t.Fatalf("Expected %#v, but %#v", want, args)
+		}
+	}
+}
+
 func TestSubShellEnv(t *testing.T) {
 	myParser := &Parser{
 		ParseEnv: true,
@@ -505,3 +614,260 @@ func TestSubShellEnv(t *testing.T) {
 		}
 	})
 }
+
+func TestTolerant(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+		spans    []Span
+	}{
+		{`foo "bar baz`, []string{"foo", "bar baz"}, []Span{{4, 12}}},
+		{`foo 'bar`, []string{"foo", "bar"}, []Span{{4, 8}}},
+		{`foo "`, []string{"foo", ""}, []Span{{4, 5}}},
+		{`foo bar\`, []string{"foo", `bar\`}, []Span{{7, 8}}},
+		{"foo `bar", []string{"foo", "`bar"}, []Span{{4, 8}}},
+		{`foo )bar (baz`, []string{"foo", ")bar", "(baz"}, []Span{{4, 5}, {9, 10}}},
+	}
+	for _, tt := range tests {
+		parser := NewParser()
+		parser.Tolerant = true
+		args, err := parser.Parse(tt.line)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.line, err)
+		}
+		if !reflect.DeepEqual(args, tt.expected) {
+			t.Fatalf("Expected %#v for %q, but %#v:", tt.expected, tt.line, args)
+		}
+		if len(parser.Diagnostics) != len(tt.spans) {
+			t.Fatalf("Expected %d diagnostics for %q, but %v", len(tt.spans), tt.line, parser.Diagnostics)
+		}
+		for i, d := range parser.Diagnostics {
+			if d.Span != tt.spans[i] || d.Severity != SeverityError {
+				t.Fatalf("Expected error at %v for %q, but %v", tt.spans[i], tt.line, d)
+			}
+		}
+
+		parser.Tolerant = false
+		if _, err := parser.Parse(tt.line); err == nil {
+			t.Fatalf("%q: Should be an error", tt.line)
+		}
+	}
+}
+
+func TestTolerantBacktickError(t *testing.T) {
+	parser := NewParser()
+	parser.ParseBacktick = true
+	parser.Tolerant = true
+	args, err := parser.Parse("echo `go Version` $(echo1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"echo", "", "$(echo1"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, args)
+	}
+	if len(parser.Diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, but %v", parser.Diagnostics)
+	}
+	if got := parser.Diagnostics[0].Span; got != (Span{5, 17}) {
+		t.Fatalf("Expected span of the backquote, but %v", got)
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	os.Setenv("FOO", "bar baz")
+
+	parser := NewParser()
+	parser.ParseEnv = true
+	tokens, err := parser.ParseTokens(`echo  "a b" $FOO; ls`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Token{
+		{Value: "echo", Span: Span{0, 4}},
+		{Value: "a b", Span: Span{6, 11}},
+		{Value: "bar", Span: Span{12, 16}},
+		{Value: "baz", Span: Span{12, 16}},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, tokens)
+	}
+}
+
+func TestLineContinuation(t *testing.T) {
+	parser := NewParser()
+	parser.ParseLineContinuation = true
+	tokens, err := parser.ParseTokens("cmd \\\n  --flag \"a\\\nb\" 'c\\\nd' e\\\nf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Token{
+		{Value: "cmd", Span: Span{0, 3}},
+		{Value: "--flag", Span: Span{8, 14}},
+		{Value: "ab", Span: Span{15, 21}},
+		{Value: "c\\\nd", Span: Span{22, 28}},
+		{Value: "ef", Span: Span{29, 33}},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, tokens)
+	}
+
+	args, err := Parse("cmd \\\n--flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cmd", "\n--flag"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v:", want, args)
+	}
+}
+
+func TestComment(t *testing.T) {
+	parser := NewParser()
+	parser.ParseComment = true
+	args, err := parser.Parse("foo bar#baz '#' \\# # comment 'here\nqux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"foo", "bar#baz", "#", "#", "qux"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, args)
+	}
+
+	parser.KeepComment = true
+	tokens, err := parser.ParseTokens("foo # bar\n#baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTokens := []Token{
+		{Kind: TokenWord, Value: "foo", Span: Span{0, 3}},
+		{Kind: TokenComment, Value: "# bar", Span: Span{4, 9}},
+		{Kind: TokenComment, Value: "#baz", Span: Span{10, 14}},
+	}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Fatalf("Expected %#v, but %#v:", expectedTokens, tokens)
+	}
+
+	args, err = Parse("foo # bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"foo", "#", "bar"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v:", want, args)
+	}
+}
+
+func TestEscapePOSIX(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`a\tb "a\tb" 'a\tb'`, []string{`atb`, `a\tb`, `a\tb`}},
+		{`C:\\Users\\me "C:\Users\me"`, []string{`C:\Users\me`, `C:\Users\me`}},
+		{`grep "^\d+\.\w*$"`, []string{`grep`, `^\d+\.\w*$`}},
+		{`"\$ \` + "`" + ` \" \\ \x"`, []string{"$ ` \" \\ \\x"}},
+		{"foo \\\n bar \"a\\\nb\" 'c\\\nd'", []string{`foo`, `bar`, `ab`, "c\\\nd"}},
+		{`var "--bar=\'baz\'"`, []string{`var`, `--bar=\'baz\'`}},
+		{`foo \& bar`, []string{`foo`, `&`, `bar`}},
+	}
+	for _, tt := range tests {
+		parser := NewParser()
+		parser.Escape = EscapePOSIX
+		args, err := parser.Parse(tt.line)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.line, err)
+		}
+		if !reflect.DeepEqual(args, tt.expected) {
+			t.Fatalf("Expected %#v for %q, but %#v:", tt.expected, tt.line, args)
+		}
+	}
+}
+
+func TestEscapePOSIXEnv(t *testing.T) {
+	env := map[string]string{"FOO": "bar  baz", "EMPTY": "", "X": "x"}
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`echo $FOO`, []string{`echo`, `bar`, `baz`}},
+		{`echo "$FOO"`, []string{`echo`, `bar  baz`}},
+		{`echo '$FOO'`, []string{`echo`, `$FOO`}},
+		{`echo \$FOO "\$FOO" "\\$X"`, []string{`echo`, `$FOO`, `$FOO`, `\x`}},
+		{`echo ${X}y $Xy $EMPTY "$EMPTY" a$EMPTY`, []string{`echo`, `xy`, ``, `a`}},
+		{`echo "" ""$EMPTY`, []string{`echo`, ``, ``}},
+		{`echo $ $1 ${X}$`, []string{`echo`, `$`, `x$`}},
+	}
+	for _, tt := range tests {
+		parser := NewParser()
+		parser.Escape = EscapePOSIX
+		parser.ParseEnv = true
+		parser.Getenv = func(k string) string { return env[k] }
+		args, err := parser.Parse(tt.line)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.line, err)
+		}
+		if !reflect.DeepEqual(args, tt.expected) {
+			t.Fatalf("Expected %#v for %q, but %#v:", tt.expected, tt.line, args)
+		}
+	}
+
+	parser := NewParser()
+	parser.Escape = EscapePOSIX
+	parser.ParseEnv = true
+	if _, err := parser.Parse(`echo ${FOO`); err == nil {
+		t.Fatal("Should be an error")
+	}
+}
+
+func TestEscapePOSIXBacktick(t *testing.T) {
+	parser := NewParser()
+	parser.Escape = EscapePOSIX
+	parser.ParseBacktick = true
+	args, err := parser.Parse(`echo $(printf '%s' a\ b) x$(printf \\\\)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"echo", "a", "b", `x\`}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, args)
+	}
+}
+
+func TestANSIC(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`echo $'line1\nline2\t\x41☺'`, []string{"echo", "line1\nline2\tA☺"}},
+		{`$'\a\b\e\E\f\r\v\\\'\"\?'`, []string{"\a\b\x1b\x1b\f\r\v\\'\"?"}},
+		{`$'\101\0\1010\x4a\x4g\xg'`, []string{"A\x00A0J\x04g\\xg"}},
+		{`$'\u263a\U0001F37A\u00e9x'`, []string{"☺🍺éx"}},
+		{`$'\cA\ca\c?\q'`, []string{"\x01\x01\x7f\\q"}},
+		{`a$'b'c $""`, []string{"abc", ""}},
+		{`$"a b" \$'c' "$"'d'`, []string{"a b", "$c", "$d"}},
+	}
+	for _, tt := range tests {
+		parser := NewParser()
+		parser.ParseANSIC = true
+		args, err := parser.Parse(tt.line)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.line, err)
+		}
+		if !reflect.DeepEqual(args, tt.expected) {
+			t.Fatalf("Expected %#v for %q, but %#v:", tt.expected, tt.line, args)
+		}
+	}
+
+	parser := NewParser()
+	parser.ParseANSIC = true
+	if _, err := parser.Parse(`echo $'foo`); err == nil {
+		t.Fatal("Should be an error")
+	}
+
+	args, err := Parse(`$'a\tb'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`$a\tb`}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v:", want, args)
+	}
+}
@@ -0,0 +1,251 @@
+package shtemplate
+
+import (
+	"fmt"
+	"text/template"
+	"text/template/parse"
+)
+
+// escaper finds the state of the script at each action of the templates,
+// and then adds the functions which quote for it.
+type escaper struct {
+	ns   *nameSpace
+	text *template.Template
+
+	// The tree being walked, for the positions in errors.
+	tree *parse.Tree
+
+	// What escaping found, like the maps of nameSpace, and the trees
+	// which are new or escaped in place.
+	derived map[derivedKey]string
+	ends    map[string]context
+	trees   map[string]*parse.Tree
+	inPlace map[string]*parse.Tree
+
+	// The templates being walked, and those of them which call themselves
+	// and so are taken to end in the state they start in.
+	walking   map[string]bool
+	recursive map[string]bool
+
+	actions map[*parse.ActionNode]context
+	calls   map[*parse.TemplateNode]string
+}
+
+func newEscaper(ns *nameSpace, text *template.Template) *escaper {
+	return &escaper{
+		ns:        ns,
+		text:      text,
+		derived:   map[derivedKey]string{},
+		ends:      map[string]context{},
+		trees:     map[string]*parse.Tree{},
+		inPlace:   map[string]*parse.Tree{},
+		walking:   map[string]bool{},
+		recursive: map[string]bool{},
+		actions:   map[*parse.ActionNode]context{},
+		calls:     map[*parse.TemplateNode]string{},
+	}
+}
+
+// template escapes the template with the given name for the state it
+// starts in, and returns the name of the escaped template and the state it
+// ends in. It is escaped in place for the start of a script, and as a copy
+// for any other state.
+func (e *escaper) template(name string, s context) (string, context, error) {
+	key := derivedKey{name, s}
+	if d, ok := e.derived[key]; ok {
+		if e.walking[d] {
+			e.recursive[d] = true
+		}
+		return d, e.ends[d], nil
+	}
+	if d, ok := e.ns.derived[key]; ok {
+		return d, e.ns.ends[d], nil
+	}
+	tmpl := e.text.Lookup(name)
+	if tmpl == nil || tmpl.Tree == nil {
+		return "", s, fmt.Errorf("shtemplate: no such template %q", name)
+	}
+	d := name
+	tree := tmpl.Tree
+	if s == (context{}) {
+		e.inPlace[d] = tree
+	} else {
+		d = fmt.Sprintf("%s$shtemplate%d", name, len(e.ns.ends)+len(e.ends))
+		if orig, ok := e.ns.orig[name]; ok {
+			tree = orig
+		}
+		tree = tree.Copy()
+		tree.Name = d
+		e.trees[d] = tree
+	}
+	e.derived[key] = d
+	e.ends[d] = s
+	e.walking[d] = true
+
+	caller := e.tree
+	e.tree = tree
+	end, err := e.list(s, tree.Root)
+	e.tree = caller
+	delete(e.walking, d)
+	if err != nil {
+		return "", s, err
+	}
+	if e.recursive[d] && end != s {
+		return "", s, fmt.Errorf("shtemplate: %s: calls itself, and ends in %s, not %s", name, end, s)
+	}
+	e.ends[d] = end
+	return d, end, nil
+}
+
+func (e *escaper) errorf(n parse.Node, format string, args ...interface{}) error {
+	loc, _ := e.tree.ErrorContext(n)
+	return fmt.Errorf("shtemplate: %s: %s", loc, fmt.Sprintf(format, args...))
+}
+
+func (e *escaper) list(s context, l *parse.ListNode) (context, error) {
+	if l == nil {
+		return s, nil
+	}
+	for _, n := range l.Nodes {
+		var err error
+		if s, err = e.node(s, n); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func (e *escaper) node(s context, n parse.Node) (context, error) {
+	switch n := n.(type) {
+	case *parse.TextNode:
+		after, err := s.scan(string(n.Text))
+		if err != nil {
+			return s, e.errorf(n, "%v", err)
+		}
+		return after, nil
+	case *parse.ActionNode:
+		// An action which sets variables writes nothing.
+		if len(n.Pipe.Decl) > 0 {
+			return s, nil
+		}
+		after, err := s.afterQuote()
+		if err != nil {
+			return s, e.errorf(n, "%v", err)
+		}
+		e.actions[n] = s
+		return after, nil
+	case *parse.IfNode:
+		return e.branch(s, &n.BranchNode, "if")
+	case *parse.WithNode:
+		return e.branch(s, &n.BranchNode, "with")
+	case *parse.RangeNode:
+		return e.rangeNode(s, n)
+	case *parse.TemplateNode:
+		d, end, err := e.template(n.Name, s)
+		if err != nil {
+			return s, err
+		}
+		e.calls[n] = d
+		return end, nil
+	case *parse.CommentNode:
+		return s, nil
+	}
+	return s, e.errorf(n, "unsupported %s", n)
+}
+
+func (e *escaper) branch(s context, n *parse.BranchNode, name string) (context, error) {
+	then, err := e.list(s, n.List)
+	if err != nil {
+		return s, err
+	}
+	otherwise, err := e.list(s, n.ElseList)
+	if err != nil {
+		return s, err
+	}
+	end, err := then.merge(otherwise)
+	if err != nil {
+		return s, e.errorf(n, "{{%s}} branches end in different contexts: %v", name, err)
+	}
+	return end, nil
+}
+
+// rangeNode walks the body of the loop until it ends in the state it
+// starts in, as the next time round does.
+func (e *escaper) rangeNode(s context, n *parse.RangeNode) (context, error) {
+	loop := s
+	for {
+		end, err := e.list(loop, n.List)
+		if err != nil {
+			return s, err
+		}
+		next, err := loop.merge(end)
+		if err != nil {
+			return s, e.errorf(n, "{{range}} ends in a different context: %v", err)
+		}
+		if next == loop {
+			break
+		}
+		loop = next
+	}
+	otherwise, err := e.list(s, n.ElseList)
+	if err != nil {
+		return s, err
+	}
+	end, err := loop.merge(otherwise)
+	if err != nil {
+		return s, e.errorf(n, "{{range}} branches end in different contexts: %v", err)
+	}
+	return end, nil
+}
+
+// commit makes the changes found by escaping.
+func (e *escaper) commit() {
+	for name, tree := range e.inPlace {
+		e.ns.orig[name] = tree.Copy()
+	}
+	for n, s := range e.actions {
+		name := e.ns.quoter(e.text, s)
+		cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos}
+		cmd.Args = []parse.Node{parse.NewIdentifier(name).SetTree(nil).SetPos(n.Pos)}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, cmd)
+	}
+	for n, d := range e.calls {
+		n.Name = d
+	}
+	for d, tree := range e.trees {
+		// The tree has no new functions, and so can't fail.
+		if _, err := e.text.AddParseTree(d, tree); err != nil {
+			panic(err)
+		}
+	}
+	for key, d := range e.derived {
+		e.ns.derived[key] = d
+	}
+	for d, s := range e.ends {
+		e.ns.ends[d] = s
+	}
+}
+
+// quoter returns the name of the function which quotes values for s,
+// adding it to the functions of text if it is new.
+func (ns *nameSpace) quoter(text *template.Template, s context) string {
+	if name, ok := ns.funcs[s]; ok {
+		return name
+	}
+	name := fmt.Sprintf("_shtemplate_quote%d", len(ns.funcs))
+	ns.funcs[s] = name
+	text.Funcs(template.FuncMap{name: func(args ...interface{}) (string, error) {
+		return s.quote(stringify(args...))
+	}})
+	return name
+}
+
+// stringify returns the text of a value, as text/template prints it.
+func stringify(args ...interface{}) string {
+	if len(args) == 1 {
+		if s, ok := args[0].(string); ok {
+			return s
+		}
+	}
+	return fmt.Sprint(args...)
+}
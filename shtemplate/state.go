@@ -0,0 +1,797 @@
+package shtemplate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// state is the kind of text at a point in a script, which tells how a
+// value put there has to be quoted.
+type state int
+
+const (
+	// stateUnquoted is between words or in an unquoted word.
+	stateUnquoted state = iota
+
+	// stateSingleQuote is in '...'.
+	stateSingleQuote
+
+	// stateDoubleQuote is in "...".
+	stateDoubleQuote
+
+	// stateANSIC is in $'...'.
+	stateANSIC
+
+	// stateHeredoc is in the body of a here-document whose delimiter is
+	// not quoted, in which $, ` and \ are special.
+	stateHeredoc
+
+	// stateHeredocQuoted is in the body of a here-document whose
+	// delimiter is quoted, as in <<'EOF', which is taken literally.
+	stateHeredocQuoted
+
+	// stateComment is in a comment.
+	stateComment
+
+	// stateBackquote is in `...`.
+	stateBackquote
+
+	// stateParam is in ${...}.
+	stateParam
+
+	// stateArith is in $((...)) or ((...)).
+	stateArith
+
+	// stateDelimiter is in the delimiter of a here-document, after <<.
+	stateDelimiter
+)
+
+func (s state) String() string {
+	switch s {
+	case stateUnquoted:
+		return "unquoted text"
+	case stateSingleQuote:
+		return "single quotes"
+	case stateDoubleQuote:
+		return "double quotes"
+	case stateANSIC:
+		return "$'...'"
+	case stateHeredoc:
+		return "here-document"
+	case stateHeredocQuoted:
+		return "quoted here-document"
+	case stateComment:
+		return "comment"
+	case stateBackquote:
+		return "backquotes"
+	case stateParam:
+		return "parameter expansion"
+	case stateArith:
+		return "arithmetic"
+	case stateDelimiter:
+		return "here-document delimiter"
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// Where a value is in an unquoted word.
+const (
+	wordStart = iota
+	wordMid
+	// wordMaybe is either, as after {{if}} branches which end differently.
+	wordMaybe
+)
+
+// Whether a word is where a command starts, for case and esac.
+const (
+	posCmd = iota
+	posArg
+	posMaybe
+)
+
+// Flags of here-documents.
+const (
+	hdDash = 1 << iota
+	hdQuoted
+)
+
+// context is where the lexer is in a script: in which quotes, nested
+// constructs and here-documents. scan moves it over the text of a script
+// given piece by piece, and quote quotes a value to go between two pieces.
+// The zero context is the start of a script. Contexts can be compared
+// with ==.
+//
+// It follows what a POSIX shell, or bash, does to find the end of each
+// construct: quotes, with bash's $'...', backslashes, comments, $(...),
+// `...`, ${...} with the quotes in it, $((...)) and ((...)), subshells,
+// the patterns of case, and here-documents, which end only at their
+// delimiter line, as ParseScript reads them. A ( followed by ( is always
+// taken as arithmetic, and case and esac only count where a command
+// starts, after an operator, a newline or a word such as then or do.
+// Anything else, like aliases or words which may or may not be reserved
+// after {{if}} branches, is not known.
+type context struct {
+	// The constructs the text is nested in, the innermost last: " for
+	// "...", ( for $(...), p for (...), ` for `...`, { for ${...}, a for
+	// $((...)) or ((...)), q for parentheses in it, k for a case before
+	// its in and K after it, and h or H for the body of a here-document,
+	// H if its delimiter is quoted.
+	stack string
+
+	// What the text is in, inside stack: ' for '...', c for $'...', # for a
+	// comment and d for the delimiter of a here-document, or 0.
+	leaf byte
+
+	// What came just before and changes what comes next: \, $, D for $(,
+	// P for (, < and H for <<, A for ) in $((...)), or 0.
+	after byte
+
+	word int
+
+	// Whether the unquoted word being read, or the next one, is where a
+	// command starts, and its first bytes, enough to tell the reserved
+	// words by. After {{if}} branches which end in different words, token
+	// has each of them, one per line.
+	pos   int
+	token string
+
+	// The here-documents which start on the next line, each a byte of
+	// flags and the delimiter, ended by a newline.
+	pending string
+
+	// The delimiter being read, its flags and the quote it is in.
+	raw      string
+	rawFlags byte
+	rawQuote byte
+
+	// The delimiter and flags of the here-document in stack, and the line
+	// of it so far, while it may still be the delimiter. lineMid is true
+	// if it can't be any more, and lineAfter if a value may have started
+	// the line.
+	delim     string
+	flags     byte
+	line      string
+	lineMid   bool
+	lineAfter bool
+}
+
+// state returns the kind of text at c.
+func (c context) state() state {
+	switch c.leaf {
+	case '\'':
+		return stateSingleQuote
+	case 'c':
+		return stateANSIC
+	case '#':
+		return stateComment
+	case 'd':
+		return stateDelimiter
+	}
+	switch c.top() {
+	case '"':
+		return stateDoubleQuote
+	case '`':
+		return stateBackquote
+	case '{':
+		return stateParam
+	case 'a', 'q':
+		return stateArith
+	case 'h':
+		return stateHeredoc
+	case 'H':
+		return stateHeredocQuoted
+	}
+	return stateUnquoted
+}
+
+func (c context) String() string {
+	s := c.state().String()
+	if c.inHeredoc() && s != stateHeredoc.String() && s != stateHeredocQuoted.String() {
+		s += " in a here-document"
+	}
+	return s
+}
+
+func (c *context) top() byte {
+	if c.stack == "" {
+		return 0
+	}
+	return c.stack[len(c.stack)-1]
+}
+
+func (c *context) push(b byte) {
+	c.stack += string([]byte{b})
+}
+
+func (c *context) pop() {
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+func (c *context) inHeredoc() bool {
+	return strings.ContainsAny(c.stack, "hH")
+}
+
+// scan returns the context after text, which comes at c.
+func (c context) scan(text string) (context, error) {
+	for i := 0; i < len(text); i++ {
+		if err := c.step(text[i]); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+func (c *context) step(b byte) error {
+	if c.inHeredoc() {
+		if end, err := c.heredocLine(b); end || err != nil {
+			return err
+		}
+	}
+
+	switch c.leaf {
+	case '\'':
+		if b == '\'' {
+			c.leaf = 0
+		}
+		return nil
+	case 'c':
+		switch {
+		case c.after == '\\':
+			c.after = 0
+		case b == '\\':
+			c.after = '\\'
+		case b == '\'':
+			c.leaf = 0
+		}
+		return nil
+	case '#':
+		if b != '\n' {
+			return nil
+		}
+		c.leaf = 0
+	case 'd':
+		if !c.readDelim(b) {
+			return nil
+		}
+	}
+
+	unquoted := c.unquoted()
+	switch c.after {
+	case '\\':
+		c.after = 0
+		return nil
+	case '$':
+		c.after = 0
+		switch {
+		case b == '\'' && unquoted:
+			c.leaf = 'c'
+			return nil
+		case b == '(':
+			c.after = 'D'
+			return nil
+		case b == '{':
+			c.push('{')
+			return nil
+		}
+	case 'D':
+		c.after = 0
+		if b == '(' {
+			c.push('a')
+			return nil
+		}
+		c.push('(')
+		c.word, c.pos, c.token = wordStart, posCmd, ""
+		unquoted = true
+	case 'P':
+		c.after = 0
+		if b == '(' {
+			c.push('a')
+			return nil
+		}
+		c.push('p')
+	case '<':
+		c.after = 0
+		if b == '<' {
+			c.after = 'H'
+			return nil
+		}
+	case 'H':
+		c.after = 0
+		switch b {
+		case '<':
+			return nil
+		case '-':
+			c.startDelim(hdDash)
+			return nil
+		}
+		c.startDelim(0)
+		if !c.readDelim(b) {
+			return nil
+		}
+	case 'A':
+		c.after = 0
+		if b == ')' {
+			c.pop()
+			c.word, c.pos = wordMid, posArg
+			return nil
+		}
+	}
+
+	if unquoted {
+		return c.stepUnquoted(b)
+	}
+	switch top := c.top(); {
+	case b == '\\' && top != 'H':
+		c.after = '\\'
+	case b == '$' && top != 'H':
+		c.after = '$'
+	case b == '`' && top != 'H' && top != '`':
+		c.push('`')
+	case b == '"' && (top == '"' || top == '{'):
+		if top == '"' {
+			c.pop()
+		} else {
+			c.push('"')
+		}
+	case b == '\'' && top == '{':
+		// Quotes in ${...} hide its }, even in double quotes.
+		c.leaf = '\''
+	case b == '`' && top == '`', b == '}' && top == '{', b == ')' && top == 'q':
+		c.pop()
+	case b == '(' && (top == 'a' || top == 'q'):
+		c.push('q')
+	case b == ')' && top == 'a':
+		c.after = 'A'
+	}
+	return nil
+}
+
+// unquoted reports whether c is in the commands of a script, rather than
+// in quotes or expansions.
+func (c *context) unquoted() bool {
+	return c.leaf == 0 && strings.IndexByte("\x00(pkK", c.top()) >= 0
+}
+
+func (c *context) stepUnquoted(b byte) error {
+	switch b {
+	case ' ', '\t', '\r', '\n', ';', '&', '|', '<', '>', '(', ')':
+		if err := c.endWord(); err != nil {
+			return err
+		}
+	}
+	switch b {
+	case ' ', '\t', '\r':
+		c.word = wordStart
+	case ';', '&', '|':
+		c.word, c.pos = wordStart, posCmd
+	case '\n':
+		c.word, c.pos = wordStart, posCmd
+		if c.pending != "" {
+			return c.startHeredoc()
+		}
+	case '>':
+		c.word = wordStart
+	case '#':
+		switch c.word {
+		case wordStart:
+			c.leaf = '#'
+			return nil
+		case wordMaybe:
+			return fmt.Errorf("# may or may not start a comment")
+		}
+		c.addToken(b)
+	case '\\', '$':
+		c.after = b
+		c.word = wordMid
+		c.addToken(b)
+	case '\'':
+		c.leaf = '\''
+		c.word = wordMid
+		c.addToken(b)
+	case '"', '`':
+		c.push(b)
+		c.word = wordMid
+		c.addToken(b)
+	case '<':
+		c.after = '<'
+		c.word = wordStart
+	case '(':
+		c.after = 'P'
+		c.word, c.pos = wordStart, posCmd
+	case ')':
+		c.word, c.pos = wordStart, posCmd
+		switch c.top() {
+		case '(':
+			c.word, c.pos = wordMid, posArg
+			c.pop()
+		case 'p':
+			c.pop()
+		case 'k':
+			return fmt.Errorf("unexpected ) in case")
+		case 'K':
+			// The end of a pattern.
+		}
+	default:
+		c.word = wordMid
+		c.addToken(b)
+	}
+	return nil
+}
+
+// addToken adds b to the unquoted word being read.
+func (c *context) addToken(b byte) {
+	words := strings.Split(c.token, "\n")
+	for i, word := range words {
+		// No reserved word is longer.
+		if len(word) < 6 {
+			words[i] += string([]byte{b})
+		}
+	}
+	c.token = strings.Join(words, "\n")
+}
+
+// endWord settles the unquoted word which ends at c: case and esac where a
+// command starts open and close a case, and after its in come patterns.
+func (c *context) endWord() error {
+	words, pos := strings.Split(c.token, "\n"), c.pos
+	c.token = ""
+	word := words[0]
+	if pos != posArg || c.top() == 'k' {
+		for _, w := range words[1:] {
+			if isReserved(w) != isReserved(word) || isReserved(w) && w != word {
+				return fmt.Errorf("%s or %s may or may not be a reserved word", word, w)
+			}
+		}
+	}
+	if word == "" {
+		return nil
+	}
+	c.pos = posArg
+	switch {
+	case word == "in" && c.top() == 'k':
+		c.pop()
+		c.push('K')
+		c.pos = posCmd
+		return nil
+	case word != "case" && word != "esac":
+		if pos != posArg && isKeepCmd(word) {
+			c.pos = pos
+		}
+		return nil
+	case pos == posMaybe:
+		return fmt.Errorf("%s may or may not be a reserved word", word)
+	case pos == posArg:
+		return nil
+	case word == "case":
+		c.push('k')
+	case c.top() == 'K':
+		c.pop()
+	}
+	return nil
+}
+
+// isReserved reports whether word is one of the reserved words which
+// change the context.
+func isReserved(word string) bool {
+	return word == "case" || word == "esac" || word == "in" || isKeepCmd(word)
+}
+
+// isKeepCmd reports whether word is a reserved word after which a command
+// starts.
+func isKeepCmd(word string) bool {
+	switch word {
+	case "if", "then", "else", "elif", "do", "while", "until", "{", "!", "time":
+		return true
+	}
+	return false
+}
+
+func (c *context) startDelim(flags byte) {
+	c.leaf = 'd'
+	c.raw = ""
+	c.rawFlags = flags
+	c.rawQuote = 0
+}
+
+// readDelim reads b in the delimiter of a here-document, and reports
+// whether b is after it.
+func (c *context) readDelim(b byte) bool {
+	switch {
+	case c.after == '\\':
+		c.after = 0
+	case c.rawQuote != 0:
+		if b == c.rawQuote {
+			c.rawQuote = 0
+		}
+	case (b == ' ' || b == '\t') && c.raw == "":
+		return false
+	case isSpace(b) || strings.IndexByte("|&;<>()", b) >= 0:
+		flags := c.rawFlags
+		if strings.ContainsAny(c.raw, `'"\`) {
+			flags |= hdQuoted
+		}
+		delim := strings.NewReplacer(`'`, "", `"`, "", `\`, "").Replace(c.raw)
+		c.pending += string([]byte{'0' + flags}) + delim + "\n"
+		c.leaf = 0
+		c.raw = ""
+		c.rawFlags = 0
+		c.word = wordStart
+		return true
+	case b == '\'' || b == '"':
+		c.rawQuote = b
+	case b == '\\':
+		c.after = '\\'
+	}
+	c.raw += string([]byte{b})
+	return false
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// startHeredoc starts the body of the first pending here-document.
+func (c *context) startHeredoc() error {
+	if c.inHeredoc() {
+		return fmt.Errorf("here-document in a here-document")
+	}
+	end := strings.IndexByte(c.pending, '\n')
+	entry := c.pending[:end]
+	c.pending = c.pending[end+1:]
+	c.flags = entry[0] - '0'
+	c.delim = entry[1:]
+	c.line, c.lineMid, c.lineAfter = "", false, false
+	if c.flags&hdQuoted != 0 {
+		c.push('H')
+	} else {
+		c.push('h')
+	}
+	if c.delim == "" {
+		return fmt.Errorf("here-document without a delimiter")
+	}
+	return nil
+}
+
+// heredocLine follows the line b is in, in the body of a here-document,
+// and reports whether it ended the here-document.
+func (c *context) heredocLine(b byte) (bool, error) {
+	if b == '\n' {
+		if !c.lineMid && c.line == c.delim {
+			if c.lineAfter {
+				return false, fmt.Errorf("%q after a value may or may not end the here-document", c.delim)
+			}
+			return true, c.endHeredoc()
+		}
+		c.line, c.lineMid, c.lineAfter = "", false, false
+		return false, nil
+	}
+	if c.lineMid || b == '\t' && c.flags&hdDash != 0 && c.line == "" {
+		return false, nil
+	}
+	c.line += string([]byte{b})
+	if !strings.HasPrefix(c.delim, c.line) {
+		c.line, c.lineMid, c.lineAfter = "", true, false
+	}
+	return false, nil
+}
+
+func (c *context) endHeredoc() error {
+	if top := c.top(); c.leaf != 0 || top != 'h' && top != 'H' {
+		return fmt.Errorf("unterminated %s in here-document", c.state())
+	}
+	c.pop()
+	c.after = 0
+	c.delim, c.flags = "", 0
+	c.line, c.lineMid, c.lineAfter = "", false, false
+	c.word, c.pos, c.token = wordStart, posCmd, ""
+	if c.pending != "" {
+		return c.startHeredoc()
+	}
+	return nil
+}
+
+// flush settles what came just before a value at c.
+func (c context) flush() (context, error) {
+	switch c.after {
+	case '\\':
+		return c, fmt.Errorf("a value can't follow a backslash")
+	case '$':
+		return c, fmt.Errorf("a value can't follow $")
+	case 'H':
+		return c, fmt.Errorf("a value can't be a here-document delimiter")
+	case 'P':
+		// A value starts with a quote, and so is not a second (.
+		c.push('p')
+	case 'D':
+		c.push('(')
+		c.word, c.pos, c.token = wordStart, posCmd, ""
+	}
+	c.after = 0
+	// Backslashes in `...` are read once more, and the words in ${...}
+	// and arithmetic are expanded in their own ways.
+	if i := strings.IndexAny(c.stack, "`{a"); i >= 0 {
+		t := context{stack: c.stack[:i+1]}
+		return c, fmt.Errorf("a value can't be put in %s", t.state())
+	}
+	return c, nil
+}
+
+// quote returns value quoted to be put at c, so that it is read back as
+// it is, in the same context. It fails if value can't be: if it has a NUL,
+// would end a comment or here-document, or if c is in backquotes, ${...},
+// arithmetic or the delimiter of a here-document. A value in unquoted text
+// is always in single quotes, so that it can't be a reserved word, an
+// assignment or a function name.
+func (c context) quote(value string) (string, error) {
+	c, err := c.flush()
+	if err != nil {
+		return "", err
+	}
+	if strings.IndexByte(value, 0) >= 0 {
+		return "", fmt.Errorf("%q has a NUL byte", value)
+	}
+	var out string
+	switch s := c.state(); s {
+	case stateUnquoted:
+		out = "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+	case stateSingleQuote:
+		out = strings.Replace(value, "'", `'\''`, -1)
+	case stateDoubleQuote:
+		out = escapeBytes(value, "\\$`\"")
+	case stateANSIC:
+		if q := (shellwords.POSIXQuoter{ANSIC: true}).Quote(value); strings.HasPrefix(q, "$'") {
+			out = q[2 : len(q)-1]
+		} else {
+			out = escapeBytes(value, `\'`)
+		}
+	case stateHeredoc:
+		out = escapeBytes(value, "\\$`")
+	case stateHeredocQuoted:
+		out = value
+	case stateComment:
+		if strings.Contains(value, "\n") {
+			return "", fmt.Errorf("%q would end the comment", value)
+		}
+		out = value
+	default:
+		return "", fmt.Errorf("a value can't be put in %s", s)
+	}
+	if c.inHeredoc() {
+		if err := c.checkLines(out); err != nil {
+			return "", err
+		}
+	}
+	return out, nil
+}
+
+// checkLines checks that no line of out, put at c, can be the delimiter of
+// the here-document.
+func (c *context) checkLines(out string) error {
+	if !c.lineMid && c.line != "" {
+		return fmt.Errorf("a value after %q may complete the here-document delimiter", c.line)
+	}
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if i == 0 && c.lineMid {
+			continue
+		}
+		if c.flags&hdDash != 0 {
+			line = strings.TrimLeft(line, "\t")
+		}
+		// The last line goes on with what comes after the value.
+		if i < len(lines)-1 && line == c.delim || i == len(lines)-1 && line != "" && strings.HasPrefix(c.delim, line) {
+			return fmt.Errorf("%q may end the here-document", out)
+		}
+	}
+	return nil
+}
+
+// afterQuote returns the context after a value quoted by quote at c, or an
+// error if quote can't put one there.
+func (c context) afterQuote() (context, error) {
+	c, err := c.flush()
+	if err != nil {
+		return c, err
+	}
+	switch s := c.state(); s {
+	case stateUnquoted:
+		c.word = wordMid
+		c.addToken('\'')
+	case stateSingleQuote, stateDoubleQuote, stateANSIC, stateHeredoc, stateHeredocQuoted, stateComment:
+	default:
+		return c, fmt.Errorf("a value can't be put in %s", s)
+	}
+	if c.inHeredoc() {
+		if err := c.checkLines(""); err != nil {
+			return c, err
+		}
+		c.lineAfter = true
+	}
+	return c, nil
+}
+
+// merge returns the context where a script may be at c or d, as after the
+// branches of a conditional, or an error if they are too different for
+// a value or text to be read the same way at both.
+func (c context) merge(d context) (context, error) {
+	if c.word != d.word {
+		c.word, d.word = wordMaybe, wordMaybe
+	}
+	if c.pos != d.pos {
+		c.pos, d.pos = posMaybe, posMaybe
+	}
+	if c.token != d.token {
+		words := strings.Split(c.token+"\n"+d.token, "\n")
+		sort.Strings(words)
+		n := 0
+		for _, w := range words {
+			if n == 0 || w != words[n-1] {
+				words[n] = w
+				n++
+			}
+		}
+		c.token = strings.Join(words[:n], "\n")
+		d.token = c.token
+	}
+	if c.lineMid != d.lineMid {
+		// A line which can't be the delimiter in one is taken as one
+		// which may have anything before it.
+		if c.lineMid {
+			c.line, c.lineMid, c.lineAfter = d.line, false, true
+		}
+		d.line, d.lineMid, d.lineAfter = c.line, false, true
+	}
+	if c.lineAfter != d.lineAfter {
+		c.lineAfter, d.lineAfter = true, true
+	}
+	if c != d {
+		return c, fmt.Errorf("%s and %s", c, d)
+	}
+	return c, nil
+}
+
+// end returns an error if a script can't end at c, as in quotes or
+// before the end of a here-document.
+func (c context) end() error {
+	if c.top() == 'h' || c.top() == 'H' {
+		// The delimiter may be the last line, without a newline.
+		if c.leaf == 0 && !c.lineMid && !c.lineAfter && c.line == c.delim {
+			if err := c.endHeredoc(); err != nil {
+				return err
+			}
+		}
+	}
+	if c.unquoted() {
+		if err := c.endWord(); err != nil {
+			return err
+		}
+	}
+	switch {
+	case c.after == 'H' || c.leaf == 'd':
+		return fmt.Errorf("here-document without a delimiter")
+	case c.after == 'P':
+		return fmt.Errorf("unterminated (")
+	case strings.ContainsAny(c.stack, "kK"):
+		return fmt.Errorf("unterminated case")
+	case c.leaf != 0 && c.leaf != '#', c.stack != "":
+		return fmt.Errorf("unterminated %s", c)
+	case c.pending != "":
+		return fmt.Errorf("here-document %q without a body", c.pending[1:strings.IndexByte(c.pending, '\n')])
+	}
+	return nil
+}
+
+// escapeBytes puts a backslash before each of the bytes of special in s.
+func escapeBytes(s, special string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(special, s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
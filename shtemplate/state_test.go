@@ -0,0 +1,310 @@
+package shtemplate
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestContextState(t *testing.T) {
+	var tests = []struct {
+		text  string
+		state state
+	}{
+		{``, stateUnquoted},
+		{`echo `, stateUnquoted},
+		{`echo '`, stateSingleQuote},
+		{`echo 'a' "`, stateDoubleQuote},
+		{`echo "a\"`, stateDoubleQuote},
+		{`echo "$(ls `, stateUnquoted},
+		{`echo "$(ls "`, stateDoubleQuote},
+		{`echo "$(ls) `, stateDoubleQuote},
+		{`echo $'a\'`, stateANSIC},
+		{`echo "$'`, stateDoubleQuote},
+		{`echo # `, stateComment},
+		{`echo a# `, stateUnquoted},
+		{"echo # a\n", stateUnquoted},
+		{"echo `", stateBackquote},
+		{`echo ${a:-`, stateParam},
+		{`echo ${a:-'}`, stateSingleQuote},
+		{`echo ${a:-'}'} `, stateUnquoted},
+		{`echo "${a:-'}'}`, stateDoubleQuote},
+		{`echo $((1 + (2 `, stateArith},
+		{`echo $((1)) `, stateUnquoted},
+		{`(( n = `, stateArith},
+		{`(( n = (1) )) && echo `, stateUnquoted},
+		{`(cd a; echo $(b) `, stateUnquoted},
+		{`( (a) ) `, stateUnquoted},
+		{`x="$(case a in a) echo "`, stateDoubleQuote},
+		{`x="$(case a in (a) echo ;; b|c) ;; esac) `, stateDoubleQuote},
+		{`x="$(case a in esac)"`, stateUnquoted},
+		{`x=$(echo case in a) `, stateUnquoted},
+		{"x=$(if a; then case $y in\n*) z ;;\nesac; fi) ", stateUnquoted},
+		{"cat <<EOF\n", stateHeredoc},
+		{"cat <<EOF\na $(b \"", stateDoubleQuote},
+		{"cat <<EOF\n'\"", stateHeredoc},
+		{"cat <<'EOF'\n$(", stateHeredocQuoted},
+		{"cat <<E\"O\"F\n", stateHeredocQuoted},
+		{"cat <<EOF\na\nEOF\n", stateUnquoted},
+		{"cat <<EOFX\na\nEOF\n", stateHeredoc},
+		{"cat <<-EOF\n\t\tEOF\n", stateUnquoted},
+		{"cat <<EOF\n\tEOF\n", stateHeredoc},
+		{"cat <<EOF <<'X'\nEOF\n", stateHeredocQuoted},
+		{"cat <<EOF <<'X'\nEOF\nX\n", stateUnquoted},
+		{"cat <<<'", stateSingleQuote},
+		{"cat << ", stateDelimiter},
+		{"cat <<E", stateDelimiter},
+		{"cat <<EOF # '", stateComment},
+		{"cat <<EOF # '\n'", stateHeredoc},
+		{"echo a\\\n", stateUnquoted},
+	}
+	for _, test := range tests {
+		// A piece at a time or all at once are the same.
+		var c context
+		for i := 0; i < len(test.text); i++ {
+			var err error
+			if c, err = c.scan(test.text[i : i+1]); err != nil {
+				t.Fatalf("%q: %v", test.text, err)
+			}
+		}
+		all, err := context{}.scan(test.text)
+		if err != nil {
+			t.Fatalf("%q: %v", test.text, err)
+		}
+		if c != all {
+			t.Fatalf("%q: %v and %v", test.text, c, all)
+		}
+		if c.state() != test.state {
+			t.Fatalf("%q: Expected %v, but %v", test.text, test.state, c.state())
+		}
+	}
+}
+
+func TestContextQuote(t *testing.T) {
+	var tests = []struct {
+		before string
+		value  string
+		want   string
+	}{
+		{`echo `, `a.txt`, `'a.txt'`},
+		{`echo `, `it's`, `'it'\''s'`},
+		{`echo `, ``, `''`},
+		{`echo `, `#a`, `'#a'`},
+		{`echo `, `~root`, `'~root'`},
+		{``, `A=1`, `'A=1'`},
+		{``, `if`, `'if'`},
+		{``, `PATH`, `'PATH'`},
+		{`echo --name=`, `a`, `'a'`},
+		{`echo ~`, `root`, `'root'`},
+		{`(`, `ls`, `'ls'`},
+		{`echo '`, `it's`, `it'\''s`},
+		{`echo "`, "$HOME `id` \\ \"", "\\$HOME \\`id\\` \\\\ \\\""},
+		{`echo $'`, "it's\n\\", `it\'s\n\\`},
+		{`echo $'`, `it's`, `it\'s`},
+		{`echo "$(ls `, `a b`, `'a b'`},
+		{`echo $(`, `ls`, `'ls'`},
+		{`echo # `, `a'b`, `a'b`},
+		{"cat <<EOF\n", "$HOME\n`id`\\", "\\$HOME\n\\`id\\`\\\\"},
+		{"cat <<'EOF'\n", "$HOME\n`id`\\", "$HOME\n`id`\\"},
+		{"cat <<EOF\n", "EOFX\nx\n", "EOFX\nx\n"},
+		{"cat <<EOF\nx", "\nEOFX", "\nEOFX"},
+		{"cat <<-EOF\n", "a\n", "a\n"},
+		{"cat <<EOF\n", "\tEOF\n", "\tEOF\n"},
+	}
+	for _, test := range tests {
+		c, err := context{}.scan(test.before)
+		if err != nil {
+			t.Fatalf("%q: %v", test.before, err)
+		}
+		got, err := c.quote(test.value)
+		if err != nil {
+			t.Fatalf("%q %q: %v", test.before, test.value, err)
+		}
+		if got != test.want {
+			t.Fatalf("%q %q: Expected %q, but %q", test.before, test.value, test.want, got)
+		}
+		if _, err := c.afterQuote(); err != nil {
+			t.Fatalf("%q: %v", test.before, err)
+		}
+	}
+}
+
+func TestContextQuoteError(t *testing.T) {
+	var tests = []struct {
+		before string
+		value  string
+	}{
+		{`echo `, "a\x00"},
+		{`echo \`, `a`},
+		{`echo $`, `HOME`},
+		{`echo "$`, `HOME`},
+		{"echo `", `a`},
+		{"echo \"`", `a`},
+		{`echo ${`, `a`},
+		{`echo "${a:-"`, `a`},
+		{`echo ${a:-'`, `a`},
+		{`echo $((`, `1`},
+		{`((`, `1`},
+		{`(( n = `, `1`},
+		{`x=1; (( n = (1 + `, `1`},
+		{`cat <<`, `EOF`},
+		{`cat <<E`, `OF`},
+		{`echo # `, "a\nrm -rf /"},
+		{"cat <<EOF\n", "a\nEOF\nrm -rf /"},
+		{"cat <<EOF\n", "EOF"},
+		{"cat <<EOF\n", "a\nE"},
+		{"cat <<EOF\nE", "OF"},
+		{"cat <<'EOF'\n", "a\nEOF\nrm -rf /"},
+		{"cat <<-EOF\n", "a\n\t\tEOF\nrm -rf /"},
+		{"cat <<-EOF\n\t", "EOF"},
+		{"cat <<EOF\n$(echo \"", "a\nEOF\nrm -rf /"},
+	}
+	for _, test := range tests {
+		c, err := context{}.scan(test.before)
+		if err != nil {
+			t.Fatalf("%q: %v", test.before, err)
+		}
+		if got, err := c.quote(test.value); err == nil {
+			t.Fatalf("%q %q: Should be an error, but %q", test.before, test.value, got)
+		}
+	}
+}
+
+func TestContextScanError(t *testing.T) {
+	c, err := context{}.scan("cat <<EOF\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = c.afterQuote(); err != nil {
+		t.Fatal(err)
+	}
+	// The value may have ended with a newline.
+	if _, err := c.scan("EOF\n"); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if _, err := c.scan("\nEOF\n"); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"cat <<A <<B\n$(cat <<C\n", "x=$(case a ) "} {
+		if _, err := (context{}).scan(text); err == nil {
+			t.Fatalf("%q: Should be an error", text)
+		}
+	}
+}
+
+func TestContextMerge(t *testing.T) {
+	start, _ := context{}.scan("echo ")
+	mid, _ := context{}.scan("echo -v")
+	m, err := start.merge(mid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.quote("a"); got != "'a'" {
+		t.Fatalf("Expected %q, but %q", "'a'", got)
+	}
+	if _, err := m.scan("#"); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if _, err := m.scan(" #"); err != nil {
+		t.Fatal(err)
+	}
+	quoted, _ := context{}.scan(`echo "`)
+	if _, err := start.merge(quoted); err == nil {
+		t.Fatal("Should be an error")
+	}
+
+	// case may or may not be where a command starts.
+	cmd, _ := context{}.scan("x; ")
+	m, err = start.merge(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.scan("case "); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if _, err := m.scan("a "); err != nil {
+		t.Fatal(err)
+	}
+
+	bol, _ := context{}.scan("cat <<EOF\n")
+	line, _ := bol.scan("abc")
+	m, err = bol.merge(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.scan("EOF\n"); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if _, err := m.quote("a\nEOF\nb"); err == nil {
+		t.Fatal("Should be an error")
+	}
+}
+
+func TestContextEnd(t *testing.T) {
+	for _, text := range []string{"", "echo a", "echo a # b", "cat <<EOF\na\nEOF", "cat <<EOF\na\nEOF\n", "case a in a) ;; esac", "(( 1 ))"} {
+		c, err := context{}.scan(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.end(); err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+	}
+	for _, text := range []string{"echo '", `echo "`, "echo $(a", "cat <<EOF", "cat <<", "cat <<EOF\na\n", "cat <<EOF\nEOF\\", "case a in a) ;;", "(( 1 )", "("} {
+		c, err := context{}.scan(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.end(); err == nil {
+			t.Fatalf("%q: Should be an error", text)
+		}
+	}
+}
+
+func TestContextShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	value := "it's \"$HOME\" `id` \\ $(id) \n\t* ~"
+	var script strings.Builder
+	for _, test := range []struct{ before, after string }{
+		{"printf '[%s]' ", ""},
+		{"printf '[%s]' 'a", "'"},
+		{"printf '[%s]' \"a", `"`},
+		{"printf '[%s]' \"$(printf %s ", `)"`},
+		{"printf '[%s]' \"$(case a in a) printf %s \"", `";; esac)"`},
+		{"cat <<EOF\n", "\nEOF"},
+		{"cat <<'EOF'\n", "\nEOF"},
+	} {
+		before, after := test.before, test.after
+		c, err := context{}.scan(before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := c.quote(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err = c.afterQuote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err = c.scan(after + "\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.end(); err != nil {
+			t.Fatal(err)
+		}
+		script.WriteString(before + q + after + "\n")
+	}
+	out, err := exec.Command("sh", "-c", script.String()).Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, script.String())
+	}
+	want := "[" + value + "]" + "[a" + value + "]" + "[a" + value + "]" + "[" + value + "]" + "[" + value + "]" + value + "\n" + value + "\n"
+	if string(out) != want {
+		t.Fatalf("Expected %q, but %q", want, out)
+	}
+}
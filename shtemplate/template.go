@@ -0,0 +1,211 @@
+// Package shtemplate implements templates which write shell scripts, like
+// text/template, but with each value quoted for where it is in the script,
+// as html/template does for HTML.
+//
+// The script around the actions is followed as a POSIX shell, or bash,
+// reads it, so that in
+//
+//	echo {{.}} "{{.}}" '{{.}}'
+//	cat <<EOF
+//	{{.}}
+//	EOF
+//
+// a value is put in single quotes as a word, escaped in double quotes,
+// escaped in single quotes and escaped in the here-document. A value in
+// unquoted text is always quoted, so that it can't be a reserved word,
+// an assignment or a function name. A value which can't be made safe
+// where it is, such as one with a NUL byte, one in a comment with a
+// newline or one with a line which would end the here-document, fails the
+// execution. Actions where no value can be put, as in backquotes, ${...},
+// $((...)), ((...)) or right after $ or a backslash, fail when the
+// template is first executed, as do branches of {{if}} or {{range}} which
+// end in different contexts and templates which end in quotes.
+//
+// The quotes, substitutions, subshells, patterns of case and
+// here-documents of the script are followed to know where the actions
+// are, but not aliases or anything else which changes how it is read.
+package shtemplate
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is a template for a shell script. Its values are quoted when
+// it is executed.
+type Template struct {
+	// escapeErr is nil until the template is escaped, and then escapeOK
+	// or the error.
+	escapeErr error
+	text      *template.Template
+	ns        *nameSpace
+}
+
+var escapeOK = fmt.Errorf("template escaped correctly")
+
+// nameSpace is what the templates associated with each other share.
+type nameSpace struct {
+	mu  sync.Mutex
+	set map[string]*Template
+
+	// escaped is true once one of the templates is, after which they
+	// can't be parsed.
+	escaped bool
+
+	// The names of the escaped templates, by the template and the state
+	// they start in, the states they end in, and the trees of those
+	// escaped in place as they were parsed.
+	derived map[derivedKey]string
+	ends    map[string]context
+	orig    map[string]*parse.Tree
+
+	// The names of the functions which quote for each state.
+	funcs map[context]string
+}
+
+type derivedKey struct {
+	name  string
+	state context
+}
+
+// FuncMap is the type of the map defining the mapping from names to
+// functions, as for text/template.
+type FuncMap map[string]interface{}
+
+// New allocates a new template with the given name.
+func New(name string) *Template {
+	ns := &nameSpace{
+		set:     map[string]*Template{},
+		derived: map[derivedKey]string{},
+		ends:    map[string]context{},
+		orig:    map[string]*parse.Tree{},
+		funcs:   map[context]string{},
+	}
+	t := &Template{text: template.New(name), ns: ns}
+	ns.set[name] = t
+	return t
+}
+
+// Must panics if err is not nil, and returns t otherwise.
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// New allocates a new template associated with t, with the same
+// delimiters and functions.
+func (t *Template) New(name string) *Template {
+	t.ns.mu.Lock()
+	defer t.ns.mu.Unlock()
+	tmpl := &Template{text: t.text.New(name), ns: t.ns}
+	t.ns.set[name] = tmpl
+	return tmpl
+}
+
+// Name returns the name of the template.
+func (t *Template) Name() string {
+	return t.text.Name()
+}
+
+// Parse parses text as the body of t, and the templates it defines with
+// {{define}}. It fails once one of the associated templates is executed.
+func (t *Template) Parse(text string) (*Template, error) {
+	t.ns.mu.Lock()
+	defer t.ns.mu.Unlock()
+	if t.ns.escaped {
+		return nil, fmt.Errorf("shtemplate: cannot Parse after Execute")
+	}
+	if _, err := t.text.Parse(text); err != nil {
+		return nil, err
+	}
+	// A {{define}} may have replaced a template.
+	for _, v := range t.text.Templates() {
+		if tmpl, ok := t.ns.set[v.Name()]; ok {
+			tmpl.text = v
+		} else {
+			t.ns.set[v.Name()] = &Template{text: v, ns: t.ns}
+		}
+	}
+	return t, nil
+}
+
+// Funcs adds the functions of funcMap to those of t, as for text/template.
+func (t *Template) Funcs(funcMap FuncMap) *Template {
+	t.text.Funcs(template.FuncMap(funcMap))
+	return t
+}
+
+// Delims sets the delimiters of the actions, as for text/template.
+func (t *Template) Delims(left, right string) *Template {
+	t.text.Delims(left, right)
+	return t
+}
+
+// Option sets options of the template, as for text/template.
+func (t *Template) Option(opt ...string) *Template {
+	t.text.Option(opt...)
+	return t
+}
+
+// Lookup returns the template with the given name associated with t, or
+// nil if there is none.
+func (t *Template) Lookup(name string) *Template {
+	t.ns.mu.Lock()
+	defer t.ns.mu.Unlock()
+	return t.ns.set[name]
+}
+
+// Execute escapes t, if it is not yet, and applies it to data, writing the
+// script to w.
+func (t *Template) Execute(w io.Writer, data interface{}) error {
+	if err := t.escape(); err != nil {
+		return err
+	}
+	return t.text.Execute(w, data)
+}
+
+// ExecuteTemplate executes the template associated with t with the given
+// name.
+func (t *Template) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	tmpl := t.Lookup(name)
+	if tmpl == nil {
+		return fmt.Errorf("shtemplate: no template %q associated with template %q", name, t.Name())
+	}
+	return tmpl.Execute(w, data)
+}
+
+// escape puts the quoting functions in t, and in the templates it calls,
+// for a script which starts with t.
+func (t *Template) escape() error {
+	ns := t.ns
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.escaped = true
+	if t.escapeErr == nil {
+		if t.text.Tree == nil {
+			return fmt.Errorf("shtemplate: %q is an incomplete or empty template", t.Name())
+		}
+		e := newEscaper(ns, t.text)
+		_, end, err := e.template(t.Name(), context{})
+		if err == nil {
+			if err = end.end(); err != nil {
+				err = fmt.Errorf("shtemplate: %s: %v", t.Name(), err)
+			}
+		}
+		if err != nil {
+			t.escapeErr = err
+			return err
+		}
+		e.commit()
+		t.escapeErr = escapeOK
+	}
+	if t.escapeErr != escapeOK {
+		return t.escapeErr
+	}
+	return nil
+}
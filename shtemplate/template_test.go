@@ -0,0 +1,177 @@
+package shtemplate
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func execute(t *testing.T, text string, data interface{}) (string, error) {
+	t.Helper()
+	tmpl, err := New("test").Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, data)
+	return b.String(), err
+}
+
+func TestExecute(t *testing.T) {
+	var tests = []struct {
+		text string
+		data interface{}
+		want string
+	}{
+		{`echo {{.}}`, "a.txt", `echo 'a.txt'`},
+		{`echo {{.}}`, "it's", `echo 'it'\''s'`},
+		{`echo {{.}}`, 42, `echo '42'`},
+		{`{{.}}`, "A=1", `'A=1'`},
+		{`echo --name={{.}}`, "a", `echo --name='a'`},
+		{`echo '{{.}}'`, "it's", `echo 'it'\''s'`},
+		{`echo "{{.}}"`, "$HOME `id`", "echo \"\\$HOME \\`id\\`\""},
+		{`echo $'{{.}}'`, "a\tb", `echo $'a\tb'`},
+		{`echo "$(ls {{.}})"`, "a b", `echo "$(ls 'a b')"`},
+		{`{{.}}=/tmp ls; {{.}}()`, "PATH", `'PATH'=/tmp ls; 'PATH'()`},
+		{`x="$(case a in a) echo "{{.}}";; esac)"`, "$(id)", `x="$(case a in a) echo "\$(id)";; esac)"`},
+		{`echo a # {{.}}`, "it's", `echo a # it's`},
+		{"cat <<EOF\n{{.}}\nEOF\n", "$HOME", "cat <<EOF\n\\$HOME\nEOF\n"},
+		{"cat <<'EOF'\n{{.}}\nEOF\n", "$HOME", "cat <<'EOF'\n$HOME\nEOF\n"},
+		{`{{$x := .}}echo {{$x}}`, "a b", `echo 'a b'`},
+		{`echo{{range .}} {{.}}{{end}}`, []string{"a", "b c"}, `echo 'a' 'b c'`},
+		{`echo {{if .}}-v{{end}} {{.}}`, "x", `echo -v 'x'`},
+		{`echo x{{if .}}-v{{end}}{{.}}`, "y", `echo x-v'y'`},
+		{`{{define "arg"}}{{.}}{{end}}echo {{template "arg" .}} "{{template "arg" .}}"`, "$a", `echo '$a' "\$a"`},
+	}
+	for _, test := range tests {
+		got, err := execute(t, test.text, test.data)
+		if err != nil {
+			t.Fatalf("%q: %v", test.text, err)
+		}
+		if got != test.want {
+			t.Fatalf("%q: Expected %q, but %q", test.text, test.want, got)
+		}
+	}
+}
+
+func TestExecuteError(t *testing.T) {
+	var tests = []struct {
+		text string
+		data interface{}
+	}{
+		{`echo {{.}}`, "a\x00"},
+		{"echo `{{.}}`", "a"},
+		{`echo ${{.}}`, "HOME"},
+		{`echo \{{.}}`, "a"},
+		{`echo ${a:-{{.}}}`, "a"},
+		{`echo $(({{.}}))`, "1"},
+		{`(( n = {{.}} ))`, "1"},
+		{`x="$(case a in b) ;; {{if .}}esac{{end}} a) echo "{{.}}";; esac)"`, "a"},
+		{`cat <<{{.}}`, "EOF"},
+		{`echo # {{.}}`, "a\nrm -rf /"},
+		{"cat <<EOF\n{{.}}\nEOF\n", "a\nEOF\nrm -rf /"},
+		{"cat <<EOF\n{{.}}EOF\n", "a\n"},
+		{`echo "{{.}}`, "a"},
+		{`echo {{if .}}"{{end}}`, "a"},
+		{`echo{{range .}} "{{.}}{{end}}`, []string{"a"}},
+		{`echo {{if .}}-v{{end}}#`, "a"},
+		{`echo {{template "none"}}`, "a"},
+	}
+	for _, test := range tests {
+		if got, err := execute(t, test.text, test.data); err == nil {
+			t.Fatalf("%q: Should be an error, but %q", test.text, got)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	tmpl := Must(New("script").Parse(`{{define "greet"}}echo "Hello, {{.}}"{{end}}{{template "greet" .}}; echo '{{template "name" .}}'`))
+	Must(tmpl.New("name").Parse(`{{.}}!`))
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, "it's"); err != nil {
+		t.Fatal(err)
+	}
+	if want := `echo "Hello, it's"; echo 'it'\''s!'`; b.String() != want {
+		t.Fatalf("Expected %q, but %q", want, b.String())
+	}
+	b.Reset()
+	if err := tmpl.ExecuteTemplate(&b, "name", "it's"); err != nil {
+		t.Fatal(err)
+	}
+	if want := `'it'\''s'!`; b.String() != want {
+		t.Fatalf("Expected %q, but %q", want, b.String())
+	}
+	if _, err := tmpl.Parse(`echo`); err == nil {
+		t.Fatal("Should be an error")
+	}
+	if err := tmpl.ExecuteTemplate(&b, "none", nil); err == nil {
+		t.Fatal("Should be an error")
+	}
+}
+
+func TestExecuteShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	tmpl := Must(New("script").Parse(`printf '[%s]' {{.}} x{{.}} '{{.}}' "{{.}}" "$(printf %s {{.}})"
+cat <<EOF
+{{.}}
+EOF
+cat <<'EOF'
+{{.}}
+EOF
+# {{printf "%q" .}}
+`))
+	value := "it's \"$HOME\" `id` \\ $(id) \t* ~"
+	var b strings.Builder
+	if err := tmpl.Execute(&b, value); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("sh", "-c", b.String()).Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, b.String())
+	}
+	want := "[" + value + "][x" + value + "][" + value + "][" + value + "][" + value + "]" + value + "\n" + value + "\n"
+	if string(out) != want {
+		t.Fatalf("Expected %q, but %q", want, out)
+	}
+}
+
+func TestExecuteShellInjection(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	// The value only writes PWNED if it is run.
+	value := "$(echo PWN''ED >&2)`echo PWN''ED >&2`"
+	var tests = []struct {
+		text string
+		want string
+	}{
+		{`x="$(case a in a) echo "{{.}}";; esac)"; printf '[%s]' "$x"`, "[" + value + "]"},
+		{`(case a in (a) printf '[%s]' {{.}};; esac)`, "[" + value + "]"},
+		{`f() { printf '[%s]' "$@"; }; {{.}}=x f {{.}}`, ""},
+	}
+	for _, shell := range []string{"sh", "bash"} {
+		if _, err := exec.LookPath(shell); err != nil {
+			continue
+		}
+		for _, test := range tests {
+			got, err := execute(t, test.text, value)
+			if err != nil {
+				t.Fatalf("%q: %v", test.text, err)
+			}
+			cmd := exec.Command(shell, "-c", got)
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			out, _ := cmd.Output()
+			if strings.Contains(stderr.String(), "PWNED") {
+				t.Fatalf("%s %q: ran the value", shell, got)
+			}
+			if test.want != "" && string(out) != test.want {
+				t.Fatalf("%s %q: Expected %q, but %q", shell, got, test.want, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package shellwords
+
+import (
+	"os/user"
+	"strings"
+	"unicode/utf8"
+)
+
+func lookupHome(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.HomeDir, nil
+}
+
+// tilde returns what the tilde-prefix ~prefix expands to.
+func (p *Parser) tilde(prefix string) (string, bool) {
+	var dir string
+	switch prefix {
+	case "":
+		dir = p.getenv("HOME")
+	case "+":
+		dir = p.getenv("PWD")
+	case "-":
+		dir = p.getenv("OLDPWD")
+	default:
+		lookup := p.LookupHome
+		if lookup == nil {
+			lookup = lookupHome
+		}
+		var err error
+		if dir, err = lookup(prefix); err != nil {
+			return "", false
+		}
+	}
+	return dir, dir != ""
+}
+
+// expandTilde expands the tilde-prefix at the start of w and, if w is an
+// assignment, the ones after '=' and each ':' of the value. Only unquoted
+// text is looked at, so '~' and "~" stay as they are. It returns where the
+// directories are in w.
+func (p *Parser) expandTilde(w *word) []Span {
+	var dirs []Span
+	var starts []int
+	assign := false
+	if w.len() > 0 && w.s[0] == '~' && w.mask[0] == unquoted {
+		starts = append(starts, 0)
+	} else if eq := strings.IndexByte(w.s, '='); eq > 0 && isName(w.s[:eq]) && isUnquoted(w.mask[:eq+1]) {
+		assign = true
+		for i := eq; i < w.len()-1; i++ {
+			if (i == eq || w.s[i] == ':' && w.mask[i] == unquoted) && w.s[i+1] == '~' && w.mask[i+1] == unquoted {
+				starts = append(starts, i+1)
+			}
+		}
+	}
+
+	// Expand from the end so the offsets which are left stay valid.
+	for n := len(starts) - 1; n >= 0; n-- {
+		at := starts[n]
+		end := at + 1
+		for end < w.len() && !(w.mask[end] == unquoted && (w.s[end] == '/' || assign && w.s[end] == ':')) {
+			end++
+		}
+		if !isUnquoted(w.mask[at:end]) {
+			continue
+		}
+		dir, ok := p.tilde(w.s[at+1 : end])
+		if !ok {
+			continue
+		}
+		var r word
+		r.add(w.s[:at], unquoted)
+		copy(r.mask, w.mask[:at])
+		r.add(dir, quoted)
+		r.add(w.s[end:], unquoted)
+		copy(r.mask[at+len(dir):], w.mask[end:])
+		for _, null := range w.nulls {
+			if null <= at {
+				r.nulls = append(r.nulls, null)
+			} else if null >= end {
+				r.nulls = append(r.nulls, null-end+at+len(dir))
+			}
+		}
+		*w = r
+		shift := len(dir) - (end - at)
+		for i := range dirs {
+			dirs[i].Start += shift
+			dirs[i].End += shift
+		}
+		dirs = append([]Span{{Start: at, End: at + len(dir)}}, dirs...)
+	}
+	return dirs
+}
+
+// protectTilde escapes the directories at dirs in s, so that replaceEnv
+// leaves them as they are and, if reparse is true, so that parsing the
+// result again does too.
+func protectTilde(s string, dirs []Span, reparse bool) string {
+	var b strings.Builder
+	last := 0
+	for _, dir := range dirs {
+		b.WriteString(s[last:dir.Start])
+		for _, r := range s[dir.Start:dir.End] {
+			switch {
+			case reparse && r < utf8.RuneSelf && !isSafe(string(r)):
+				b.WriteString(`\\\`)
+			case !reparse && (r == '\\' || r == '$'):
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		}
+		last = dir.End
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func isUnquoted(mask []quoting) bool {
+	for _, q := range mask {
+		if q != unquoted {
+			return false
+		}
+	}
+	return true
+}
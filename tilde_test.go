@@ -0,0 +1,76 @@
+package shellwords
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTilde(t *testing.T) {
+	env := map[string]string{"HOME": "/home/me", "PWD": "/work", "OLDPWD": "/old", "X": "~"}
+	homes := map[string]string{"alice": "/home/alice"}
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`~ ~/bin/tool ~alice/config ~bob/x`, []string{"/home/me", "/home/me/bin/tool", "/home/alice/config", "~bob/x"}},
+		{`~+ ~-/f a~ '~' "~"/x \~`, []string{"/work", "/old/f", "a~", "~", "~/x", "~"}},
+		{`PATH=~/bin:~alice/bin:/usr/~ --dir=~`, []string{"PATH=/home/me/bin:/home/alice/bin:/usr/~", "--dir=~"}},
+		{`A=~:'~' "A"=~`, []string{"A=/home/me:~", "A=~"}},
+		{`~"/x" ~\/x ~alice"/x" A=~":"`, []string{"~/x", "~/x", "~alice/x", "A=~:"}},
+	}
+	for _, mode := range []EscapeMode{EscapeLegacy, EscapePOSIX} {
+		for _, tt := range tests {
+			parser := NewParser()
+			parser.Escape = mode
+			parser.ParseTilde = true
+			parser.Getenv = func(k string) string { return env[k] }
+			parser.LookupHome = func(name string) (string, error) {
+				if dir, ok := homes[name]; ok {
+					return dir, nil
+				}
+				return "", errors.New("no such user")
+			}
+			args, err := parser.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("%q: %v", tt.line, err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Fatalf("Expected %#v for %q, but %#v:", tt.expected, tt.line, args)
+			}
+		}
+	}
+}
+
+func TestTildeWithEnv(t *testing.T) {
+	parser := NewParser()
+	parser.Escape = EscapePOSIX
+	parser.ParseEnv = true
+	parser.ParseTilde = true
+	parser.Getenv = func(k string) string { return map[string]string{"HOME": "/home/my dir", "X": "~"}[k] }
+	args, err := parser.Parse(`~/bin $X/bin`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/home/my dir/bin", "~/bin"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, args)
+	}
+}
+
+func TestTildeWithEnvLegacy(t *testing.T) {
+	parser := NewParser()
+	parser.ParseEnv = true
+	parser.ParseTilde = true
+	parser.Getenv = func(k string) string {
+		return map[string]string{"HOME": `/home/a b\c $X'"`, "X": "x"}[k]
+	}
+	args, err := parser.Parse(`~/f ~/"g" $X`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`/home/a b\c $X'"/f`, `/home/a b\c $X'"/g`, "x"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %#v, but %#v:", expected, args)
+	}
+}
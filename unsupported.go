@@ -0,0 +1,107 @@
+package shellwords
+
+import (
+	"fmt"
+)
+
+// UnsupportedError is returned by Parse when RejectUnsupported is set and
+// the line is a shell construct rather than a simple command.
+type UnsupportedError struct {
+	// Construct describes what was found, such as `reserved word "if"`
+	// or "subshell".
+	Construct string
+	Span      Span
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("unsupported shell construct at %d: %s", e.Span.Start, e.Construct)
+}
+
+var reservedWords = map[string]bool{
+	"!": true, "{": true, "}": true, "case": true, "do": true, "done": true,
+	"elif": true, "else": true, "esac": true, "fi": true, "for": true,
+	"if": true, "in": true, "then": true, "until": true, "while": true,
+	"function": true, "select": true, "[[": true, "]]": true,
+}
+
+// checkSupported looks at the first command of line for constructs which
+// Parse would turn into misleading arguments.
+func (p *Parser) checkSupported(line string) error {
+	lx := &scriptLexer{p: p, src: line}
+	t, err := lx.next()
+	if err != nil {
+		// Leave it to Parse to report.
+		return nil
+	}
+	unsupported := func(construct string, span Span) error {
+		return p.fail(span, &UnsupportedError{Construct: construct, Span: span})
+	}
+	switch {
+	case t.isOp("(") && lx.off < len(line) && line[lx.off] == '(':
+		return unsupported("arithmetic command", Span{Start: t.span.Start, End: len(line)})
+	case t.isOp("("):
+		return unsupported("subshell", Span{Start: t.span.Start, End: len(line)})
+	case t.isWord("{"):
+		return unsupported("brace group", Span{Start: t.span.Start, End: len(line)})
+	case t.kind == tWord && reservedWords[t.val]:
+		return unsupported(fmt.Sprintf("reserved word %q", t.val), t.span)
+	}
+
+	// A line of assignments and redirections only sets variables.
+	first, end := t.span.Start, t.span.Start
+	assigns := 0
+	for {
+		switch {
+		case t.kind == tIONumber || t.kind == tOp && redirectOps[t.val]:
+			if t.kind == tIONumber {
+				if _, err = lx.next(); err != nil {
+					return nil
+				}
+			}
+			if t, err = lx.next(); err != nil {
+				return nil
+			}
+		case t.kind == tWord && isAssignment(t.val):
+			assigns++
+		case t.kind == tWord:
+			name := t
+			if t, err = lx.next(); err != nil {
+				return nil
+			}
+			if t.isOp("(") && end == first && isName(name.val) {
+				return unsupported("function definition", Span{Start: name.span.Start, End: len(line)})
+			}
+			return nil
+		default:
+			if assigns > 0 {
+				return unsupported("assignment", Span{Start: first, End: end})
+			}
+			return nil
+		}
+		end = t.span.End
+		if t, err = lx.next(); err != nil {
+			return nil
+		}
+	}
+}
+
+// construct describes cmd for an UnsupportedError.
+func construct(cmd CommandNode) string {
+	switch cmd.(type) {
+	case *Subshell:
+		return "subshell"
+	case *BraceGroup:
+		return "brace group"
+	case *IfClause:
+		return "if clause"
+	case *CaseClause:
+		return "case clause"
+	case *ForClause:
+		return "for loop"
+	case *WhileClause:
+		return "while loop"
+	case *FuncDecl:
+		return "function definition"
+	}
+	return "simple command"
+}
@@ -0,0 +1,76 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRejectUnsupported(t *testing.T) {
+	var tests = []struct {
+		line      string
+		construct string
+		span      Span
+	}{
+		{`if true; then x; fi`, `reserved word "if"`, Span{0, 2}},
+		{`for f in *; do`, `reserved word "for"`, Span{0, 3}},
+		{`  while :; do :; done`, `reserved word "while"`, Span{2, 7}},
+		{`! false`, `reserved word "!"`, Span{0, 1}},
+		{`fi`, `reserved word "fi"`, Span{0, 2}},
+		{`(cd dir && make)`, `subshell`, Span{0, 16}},
+		{`((i++))`, `arithmetic command`, Span{0, 7}},
+		{`{ a; b; }`, `brace group`, Span{0, 9}},
+		{`f() { echo; }`, `function definition`, Span{0, 13}},
+		{`FOO=bar`, `assignment`, Span{0, 7}},
+		{`A=1 B="x y" >out ; echo`, `assignment`, Span{0, 16}},
+	}
+	for _, test := range tests {
+		parser := NewParser()
+		parser.RejectUnsupported = true
+		_, err := parser.Parse(test.line)
+		e, ok := err.(*UnsupportedError)
+		if !ok {
+			t.Fatalf("%q: Expected *UnsupportedError, but %v", test.line, err)
+		}
+		if e.Construct != test.construct || e.Span != test.span {
+			t.Fatalf("%q: Expected %s at %v, but %s at %v", test.line, test.construct, test.span, e.Construct, e.Span)
+		}
+	}
+
+	for _, test := range []struct {
+		line string
+		args []string
+	}{
+		{`echo if then fi`, []string{"echo", "if", "then", "fi"}},
+		{`'if' true`, []string{"if", "true"}},
+		{`FOO=bar env`, []string{"FOO=bar", "env"}},
+		{`echo {} >out`, []string{"echo", "{}"}},
+		{`./=x`, []string{"./=x"}},
+		{``, []string{}},
+	} {
+		parser := NewParser()
+		parser.RejectUnsupported = true
+		args, err := parser.Parse(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("%q: Expected %#v, but %#v", test.line, test.args, args)
+		}
+	}
+}
+
+func TestRejectUnsupportedTolerant(t *testing.T) {
+	parser := NewParser()
+	parser.RejectUnsupported = true
+	parser.Tolerant = true
+	args, err := parser.Parse(`if true`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"if", "true"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Expected %#v, but %#v", want, args)
+	}
+	if len(parser.Diagnostics) != 1 || parser.Diagnostics[0].Span != (Span{0, 2}) {
+		t.Fatalf("Expected a diagnostic at 0-2, but %v", parser.Diagnostics)
+	}
+}
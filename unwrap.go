@@ -0,0 +1,217 @@
+package shellwords
+
+import (
+	"strings"
+)
+
+// WrapperSpec describes the options of a command which runs the command
+// given in its arguments, like sudo or env.
+type WrapperSpec struct {
+	// ShortArgs are the letters of the short options which take an
+	// argument, and LongArgs the names of the long ones, without "--".
+	// Other options are taken to have none.
+	ShortArgs string
+	LongArgs  []string
+
+	// Operands is the number of words after the options which come before
+	// the command, like the duration of timeout.
+	Operands int
+
+	// If Assigns is true, NAME=value words before the command are
+	// assignments to its environment, as for env.
+	Assigns bool
+
+	// ClearEnv are the options, as written, which start the command with
+	// an empty environment.
+	ClearEnv []string
+
+	// SplitString are the options, as written, whose argument is split
+	// into words which come after it, as for env -S. They are read like
+	// the words after the options.
+	SplitString []string
+}
+
+// DefaultWrappers are the wrappers which Unwrap knows, by command name.
+var DefaultWrappers = map[string]WrapperSpec{
+	"chroot":  {LongArgs: []string{"groups", "userspec"}, Operands: 1},
+	"command": {},
+	"doas":    {ShortArgs: "Cu"},
+	"env": {
+		ShortArgs:   "CSu",
+		LongArgs:    []string{"chdir", "split-string", "unset", "block-signal", "default-signal", "ignore-signal"},
+		Assigns:     true,
+		ClearEnv:    []string{"-", "-i", "--ignore-environment"},
+		SplitString: []string{"-S", "--split-string"},
+	},
+	"exec":   {ShortArgs: "a"},
+	"ionice": {ShortArgs: "cnp", LongArgs: []string{"class", "classdata", "pid", "pgid", "uid"}},
+	"nice":   {ShortArgs: "n", LongArgs: []string{"adjustment"}},
+	"nohup":  {},
+	"stdbuf": {ShortArgs: "ioe", LongArgs: []string{"input", "output", "error"}},
+	"sudo": {
+		ShortArgs: "CDghpRrTtUu",
+		LongArgs:  []string{"close-from", "chdir", "group", "host", "prompt", "chroot", "role", "command-timeout", "type", "other-user", "user"},
+		Assigns:   true,
+	},
+	"time":    {ShortArgs: "fo", LongArgs: []string{"format", "output"}},
+	"timeout": {ShortArgs: "ks", LongArgs: []string{"kill-after", "signal"}, Operands: 1},
+	"xargs": {
+		ShortArgs: "adEILnPs",
+		LongArgs:  []string{"arg-file", "delimiter", "max-lines", "max-args", "max-procs", "max-chars", "process-slot-var"},
+	},
+}
+
+// Wrapper is a wrapper taken off a command line by Unwrap.
+type Wrapper struct {
+	// Name is the name in DefaultWrappers, and Args the words of the
+	// wrapper, from its command name up to the command it runs.
+	Name string
+	Args []string
+}
+
+// Unwrapped is a command line with its wrappers taken off.
+type Unwrapped struct {
+	// Wrappers are the wrappers, the outermost first.
+	Wrappers []Wrapper
+
+	// Envs are the assignments of the line and of the wrappers, as
+	// NAME=value in the order they are made.
+	Envs []string
+
+	// ClearEnv is true if a wrapper starts the command with an empty
+	// environment, as env -i does. Envs has only the assignments after it
+	// then.
+	ClearEnv bool
+
+	// Args is the command which runs in the end. It is empty if the last
+	// wrapper has no command, like a bare env.
+	Args []string
+}
+
+// Unwrap takes the wrappers in DefaultWrappers off args, such as sudo and
+// nice in sudo -u root nice -n 10 make, and returns what is left.
+func Unwrap(args []string) *Unwrapped {
+	u := &Unwrapped{Args: args}
+	for len(u.Args) > 0 {
+		name := u.Args[0]
+		if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+			name = name[i+1:]
+		}
+		spec, ok := DefaultWrappers[name]
+		if !ok {
+			break
+		}
+		args, n := u.unwrap(spec, u.Args)
+		u.Wrappers = append(u.Wrappers, Wrapper{Name: name, Args: args[:n]})
+		u.Args = args[n:]
+	}
+	return u
+}
+
+// unwrap skips the options, operands and assignments of the wrapper in
+// args, and returns args, with the words of split strings put in, and the
+// index of the command it runs.
+func (u *Unwrapped) unwrap(spec WrapperSpec, args []string) ([]string, int) {
+	clear := func(opt string) {
+		for _, o := range spec.ClearEnv {
+			if o == opt {
+				u.ClearEnv = true
+				u.Envs = nil
+			}
+		}
+	}
+	// split puts the words of value, the argument of opt at i, after it.
+	split := func(opt, value string, i int) {
+		for _, o := range spec.SplitString {
+			if o == opt {
+				words := splitString(value)
+				args = append(append(args[:i+1:i+1], words...), args[i+1:]...)
+			}
+		}
+	}
+
+	i := 1
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			i++
+			break
+		}
+		if arg == "-" {
+			clear(arg)
+			continue
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			name := arg[2:]
+			if eq := strings.IndexByte(name, '='); eq >= 0 {
+				name = name[:eq]
+				split("--"+name, arg[eq+3:], i)
+			} else {
+				for _, a := range spec.LongArgs {
+					if a == name {
+						if i++; i < len(args) {
+							split("--"+name, args[i], i)
+						}
+					}
+				}
+			}
+			clear("--" + name)
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			clear("-" + arg[j:j+1])
+			if strings.IndexByte(spec.ShortArgs, arg[j]) >= 0 {
+				// The rest of the word is the argument, or else the next
+				// word.
+				if j < len(arg)-1 {
+					split("-"+arg[j:j+1], arg[j+1:], i)
+				} else if i++; i < len(args) {
+					split("-"+arg[j:j+1], args[i], i)
+				}
+				break
+			}
+		}
+	}
+
+	i += spec.Operands
+	for ; spec.Assigns && i < len(args) && isAssignment(args[i]); i++ {
+		u.Envs = append(u.Envs, args[i])
+	}
+	if i > len(args) {
+		i = len(args)
+	}
+	return args, i
+}
+
+// splitString splits s into words as env -S does, with quotes and
+// backslashes but no expansions. If it can't, it splits s at spaces.
+func splitString(s string) []string {
+	words, err := (&Parser{Escape: EscapePOSIX}).Parse(s)
+	if err != nil {
+		return strings.Fields(s)
+	}
+	return words
+}
+
+// ParseUnwrapped parses line with ParseWithEnvs and unwraps the command. The
+// assignments before the command come first in Envs.
+func (p *Parser) ParseUnwrapped(line string) (*Unwrapped, error) {
+	envs, args, err := p.ParseWithEnvs(line)
+	if err != nil {
+		return nil, err
+	}
+	u := Unwrap(args)
+	if !u.ClearEnv {
+		u.Envs = append(envs, u.Envs...)
+	}
+	return u, nil
+}
+
+// ParseUnwrapped parses line with the default parser and unwraps the
+// command.
+func ParseUnwrapped(line string) (*Unwrapped, error) {
+	return NewParser().ParseUnwrapped(line)
+}
@@ -0,0 +1,62 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnwrap(t *testing.T) {
+	var tests = []struct {
+		line     string
+		wrappers []string
+		envs     []string
+		clear    bool
+		args     []string
+	}{
+		{`make all`, nil, []string{}, false, []string{"make", "all"}},
+		{
+			`sudo -E env -i FOO=1 nice -n 10 timeout 5s ./deploy.sh --prod`,
+			[]string{"sudo", "env", "nice", "timeout"}, []string{"FOO=1"}, true, []string{"./deploy.sh", "--prod"},
+		},
+		{
+			`A=1 /usr/bin/sudo -u root -g wheel B=2 nohup stdbuf -oL -e 0 xargs -0 -n1 -I{} rm -- {}`,
+			[]string{"sudo", "nohup", "stdbuf", "xargs"}, []string{"A=1", "B=2"}, false, []string{"rm", "--", "{}"},
+		},
+		{`A=1 env - B=2 env -- C=3 cmd`, []string{"env", "env"}, []string{"B=2", "C=3"}, true, []string{"cmd"}},
+		{`timeout --signal=KILL -k 1 10 time -p exec -a x command -p ls`, []string{"timeout", "time", "exec", "command"}, []string{}, false, []string{"ls"}},
+		{`doas -u www ionice -c2 -n 7 chroot --userspec=a:b /srv/root /bin/sh`, []string{"doas", "ionice", "chroot"}, []string{}, false, []string{"/bin/sh"}},
+		{`env -u HOME`, []string{"env"}, []string{}, false, []string{}},
+		{`timeout`, []string{"timeout"}, []string{}, false, []string{}},
+		{`env -S 'sh -c id'`, []string{"env"}, []string{}, false, []string{"sh", "-c", "id"}},
+		{`env -S'-i FOO=1 sudo "rm -f"' x`, []string{"env", "sudo"}, []string{"FOO=1"}, true, []string{"rm -f", "x"}},
+		{`env --split-string='nice -n 5 make' all`, []string{"env", "nice"}, []string{}, false, []string{"make", "all"}},
+	}
+	for _, test := range tests {
+		u, err := ParseUnwrapped(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wrappers []string
+		for _, w := range u.Wrappers {
+			wrappers = append(wrappers, w.Name)
+		}
+		if !reflect.DeepEqual(wrappers, test.wrappers) {
+			t.Fatalf("%q: Expected wrappers %#v, but %#v", test.line, test.wrappers, wrappers)
+		}
+		if !reflect.DeepEqual(u.Envs, test.envs) || u.ClearEnv != test.clear {
+			t.Fatalf("%q: Expected envs %#v %v, but %#v %v", test.line, test.envs, test.clear, u.Envs, u.ClearEnv)
+		}
+		if !reflect.DeepEqual(u.Args, test.args) {
+			t.Fatalf("%q: Expected %#v, but %#v", test.line, test.args, u.Args)
+		}
+	}
+
+	u := Unwrap([]string{"nice", "-n", "5", "make"})
+	if want := []string{"nice", "-n", "5"}; !reflect.DeepEqual(u.Wrappers[0].Args, want) {
+		t.Fatalf("Expected %#v, but %#v", want, u.Wrappers[0].Args)
+	}
+	u = Unwrap([]string{"env", "-S", "A=1 make", "all"})
+	if want := []string{"env", "-S", "A=1 make", "A=1"}; !reflect.DeepEqual(u.Wrappers[0].Args, want) {
+		t.Fatalf("Expected %#v, but %#v", want, u.Wrappers[0].Args)
+	}
+}
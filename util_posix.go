@@ -10,7 +10,7 @@ import (
 	"strings"
 )
 
-func shellRun(line, dir string) (string, error) {
+func shellCommand(line, dir string) *exec.Cmd {
 	var shell string
 	if shell = os.Getenv("SHELL"); shell == "" {
 		shell = "/bin/sh"
@@ -19,7 +19,11 @@ func shellRun(line, dir string) (string, error) {
 	if dir != "" {
 		cmd.Dir = dir
 	}
-	b, err := cmd.Output()
+	return cmd
+}
+
+func shellRun(line, dir string) (string, error) {
+	b, err := shellCommand(line, dir).Output()
 	if err != nil {
 		if eerr, ok := err.(*exec.ExitError); ok {
 			b = eerr.Stderr
@@ -28,3 +32,11 @@ func shellRun(line, dir string) (string, error) {
 	}
 	return strings.TrimSpace(string(b)), nil
 }
+
+// envKey returns the key under which the variable name is unique.
+func envKey(name string) string {
+	return name
+}
+
+// HostDialect is the Dialect of the system this program runs on.
+const HostDialect = DialectPOSIX
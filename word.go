@@ -0,0 +1,103 @@
+package shellwords
+
+// quoting tells how a byte of a word was written. The stages which run once
+// a word is complete look at it to leave quoted text alone.
+type quoting byte
+
+const (
+	unquoted quoting = iota // written literally outside of quotes
+	quoted                  // written inside quotes or escaped
+	expanded                // result of an unquoted expansion
+)
+
+// word is the word being built by the parser.
+type word struct {
+	s    string
+	mask []quoting
+
+	// Offsets in s where a pair of quotes was closed. They keep "" and
+	// "$EMPTY" as empty words instead of nothing.
+	nulls []int
+}
+
+func (w *word) add(s string, q quoting) {
+	w.s += s
+	for i := 0; i < len(s); i++ {
+		w.mask = append(w.mask, q)
+	}
+}
+
+func (w *word) null() {
+	w.nulls = append(w.nulls, len(w.s))
+}
+
+func (w *word) len() int {
+	return len(w.s)
+}
+
+func (w *word) truncate(n int) {
+	w.s = w.s[:n]
+	w.mask = w.mask[:n]
+	for i, at := range w.nulls {
+		if at > n {
+			w.nulls = w.nulls[:i]
+			break
+		}
+	}
+}
+
+func (w *word) reset() {
+	w.s = ""
+	w.mask = w.mask[:0]
+	w.nulls = w.nulls[:0]
+}
+
+// fields splits w at the whitespace which came from unquoted expansions.
+func (w *word) fields() []word {
+	var fields []word
+	var cur word
+	have := false
+	n := 0
+	for i := 0; i <= len(w.s); i++ {
+		for ; n < len(w.nulls) && w.nulls[n] == i; n++ {
+			have = true
+		}
+		if i == len(w.s) {
+			break
+		}
+		if w.mask[i] == expanded && isSpace(rune(w.s[i])) {
+			if have {
+				fields = append(fields, cur)
+			}
+			cur = word{}
+			have = false
+			continue
+		}
+		cur.add(w.s[i:i+1], w.mask[i])
+		have = true
+	}
+	if have {
+		fields = append(fields, cur)
+	}
+	return fields
+}
+
+// slice returns the part of w from i to j.
+func (w *word) slice(i, j int) word {
+	r := word{s: w.s[i:j], mask: append([]quoting(nil), w.mask[i:j]...)}
+	for _, at := range w.nulls {
+		if i <= at && at <= j {
+			r.nulls = append(r.nulls, at-i)
+		}
+	}
+	return r
+}
+
+// append adds o to the end of w.
+func (w *word) append(o word) {
+	for _, at := range o.nulls {
+		w.nulls = append(w.nulls, w.len()+at)
+	}
+	w.s += o.s
+	w.mask = append(w.mask, o.mask...)
+}